@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/system"
+)
+
+const DefaultPort = 8765
+
+// Server serves the connections as JSON on the loopback interface
+type Server struct {
+	collector system.Collector
+	port      int
+	token     string
+
+	metricsLabelLimit int
+	rates             *system.RateMeter
+
+	server *http.Server
+}
+
+// NewServer creates the API server. When token is not empty, requests
+// must carry "Authorization: Bearer <token>".
+func NewServer(collector system.Collector, port int, token string) *Server {
+	var c Server
+	c.collector = collector
+	c.port = port
+	c.token = token
+	c.metricsLabelLimit = DefaultMetricsLabelLimit
+	c.rates = system.NewRateMeter()
+	return &c
+}
+
+func (c *Server) Addr() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(c.port))
+}
+
+// Start listens on 127.0.0.1 and serves in the background
+func (c *Server) Start() error {
+	listener, err := net.Listen("tcp", c.Addr())
+	if err != nil {
+		return err
+	}
+	c.server = &http.Server{
+		Handler:           c.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := c.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Println("api server error:", err)
+		}
+	}()
+	return nil
+}
+
+func (c *Server) Stop() {
+	if c.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.server.Shutdown(ctx)
+	c.server = nil
+}
+
+func (c *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /connections", c.handleConnections)
+	mux.HandleFunc("GET /listeners", c.handleListeners)
+	mux.HandleFunc("GET /processes/{pid}", c.handleProcess)
+	mux.HandleFunc("GET /metrics", c.handleMetrics)
+	return c.authorize(mux)
+}
+
+func (c *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.token != "" {
+			auth := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(auth, "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// snapshot takes a filtered snapshot. Rates are measured since the
+// previous request that saw the same connection.
+func (c *Server) snapshot(r *http.Request, filterType string, filterStatus string) ([]system.ConnectionInfo, error) {
+	conns, err := system.SnapshotFiltered(r.Context(), c.collector, filterType, filterStatus)
+	if err != nil {
+		return nil, err
+	}
+	c.rates.Update(conns, time.Now())
+	return conns, nil
+}
+
+// handleConnections supports the filters of the top panel:
+// proto=tcp|udp|unix|all, state=LISTEN|ESTABLISHED|OTHER|ALL,
+// container=<text>, netns=<namespace>, q=<query>, sort=<column>, desc=1
+func (c *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filterType := strings.ToLower(queryValue(query.Get("proto"), "all"))
+	if !slices.Contains(system.FilterTypes, filterType) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid proto: %s", filterType))
+		return
+	}
+	filterStatus := strings.ToUpper(queryValue(query.Get("state"), "ALL"))
+	if !slices.Contains(system.FilterStatuses, filterStatus) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid state: %s", filterStatus))
+		return
+	}
+
+	search, err := system.ParseQuery(query.Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conns, err := c.snapshot(r, filterType, filterStatus)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	conns = system.FilterContainer(conns, query.Get("container"))
+	conns = system.FilterNamespace(conns, query.Get("netns"))
+	conns = system.FilterQuery(conns, search)
+	if !sortConnections(w, r, conns) {
+		return
+	}
+	writeJSON(w, http.StatusOK, system.NewConnectionRecords(conns))
+}
+
+// handleListeners returns listening TCP and UNIX sockets and unconnected
+// UDP sockets
+func (c *Server) handleListeners(w http.ResponseWriter, r *http.Request) {
+	filterType := strings.ToLower(queryValue(r.URL.Query().Get("proto"), "all"))
+	if !slices.Contains(system.FilterTypes, filterType) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid proto: %s", filterType))
+		return
+	}
+	search, err := system.ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// UDP has no LISTEN state, so only queries without UDP can narrow the snapshot
+	filterStatus := "ALL"
+	if filterType == "tcp" || filterType == "unix" {
+		filterStatus = "LISTEN"
+	}
+	conns, err := c.snapshot(r, filterType, filterStatus)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	conns = system.FilterNamespace(conns, r.URL.Query().Get("netns"))
+	listeners := make([]system.ConnectionInfo, 0)
+	for _, conn := range system.FilterQuery(conns, search) {
+		if conn.State == "LISTEN" || (conn.Protocol == "UDP" && conn.RemotePort == 0) {
+			listeners = append(listeners, conn)
+		}
+	}
+	if !sortConnections(w, r, listeners) {
+		return
+	}
+	writeJSON(w, http.StatusOK, system.NewConnectionRecords(listeners))
+}
+
+type processResponse struct {
+	PID         uint32                    `json:"pid"`
+	ParentPID   uint32                    `json:"parent_pid"`
+	Program     string                    `json:"program"`
+	Path        string                    `json:"path"`
+	CommandLine string                    `json:"command_line"`
+	User        string                    `json:"user"`
+	StartTime   string                    `json:"start_time"`
+	Connections []system.ConnectionRecord `json:"connections"`
+}
+
+func (c *Server) handleProcess(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.ParseUint(r.PathValue("pid"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid pid: %s", r.PathValue("pid")))
+		return
+	}
+
+	conns, err := c.snapshot(r, "all", "ALL")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	owned := make([]system.ConnectionInfo, 0)
+	for _, conn := range conns {
+		if conn.PID == uint32(pid) {
+			owned = append(owned, conn)
+		}
+	}
+
+	process := system.ProcessInfo{PID: uint32(pid), Name: "?"}
+	if system.Instance != nil {
+		process = system.Instance.GetProcess(uint32(pid))
+	}
+
+	var result processResponse
+	result.PID = process.PID
+	result.ParentPID = process.ParentPID
+	result.Program = process.Name
+	result.Path = process.ExePath
+	result.CommandLine = process.CommandLine
+	result.User = process.User
+	if !process.StartTime.IsZero() {
+		result.StartTime = process.StartTime.Format(time.RFC3339)
+	}
+	if result.Program == "?" && len(owned) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("process not found: %d", pid))
+		return
+	}
+	system.SortConnections(owned, system.ColumnLocalPort, true)
+	result.Connections = system.NewConnectionRecords(owned)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func sortConnections(w http.ResponseWriter, r *http.Request, conns []system.ConnectionInfo) bool {
+	query := r.URL.Query()
+	column := queryValue(query.Get("sort"), system.ColumnLocalPort)
+	if !slices.Contains(system.SortColumns, column) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid sort column: %s", column))
+		return false
+	}
+	desc := query.Get("desc") == "1" || query.Get("desc") == "true"
+	system.SortConnections(conns, column, !desc)
+	return true
+}
+
+func queryValue(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u00io/localports/system"
+)
+
+func fakeConnections() []system.ConnectionInfo {
+	return []system.ConnectionInfo{
+		{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 8080, RemoteAddr: "0.0.0.0", State: "LISTEN", PID: 100, ProcessName: "nginx"},
+		{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 5432, RemoteAddr: "0.0.0.0", State: "LISTEN", PID: 200, ProcessName: "postgres"},
+		{Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: 50000, RemoteAddr: "10.0.0.9", RemotePort: 5432, State: "ESTABLISHED", PID: 300, ProcessName: "psql"},
+		{Protocol: "UDP", LocalAddr: "0.0.0.0", LocalPort: 53, PID: 400, ProcessName: "dnsmasq"},
+		{Protocol: "UDP", LocalAddr: "10.0.0.5", LocalPort: 40000, RemoteAddr: "10.0.0.1", RemotePort: 53, PID: 400, ProcessName: "dnsmasq"},
+	}
+}
+
+// get sends a request to the handler and decodes the JSON response
+func get(t *testing.T, handler http.Handler, url string, token string, result any) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if result != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			t.Fatalf("GET %s: %v in %q", url, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func localPorts(records []system.ConnectionRecord) []uint16 {
+	var result []uint16
+	for _, record := range records {
+		result = append(result, record.LocalPort)
+	}
+	return result
+}
+
+func equalPorts(a []uint16, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConnections(t *testing.T) {
+	handler := NewServer(system.NewFakeCollector(fakeConnections()), 0, "").Handler()
+
+	tests := []struct {
+		url   string
+		ports []uint16
+	}{
+		{"/connections", []uint16{53, 5432, 8080, 40000, 50000}},
+		{"/connections?proto=tcp&state=LISTEN", []uint16{5432, 8080}},
+		{"/connections?proto=udp", []uint16{53, 40000}},
+		{"/connections?sort=local_port&desc=1", []uint16{50000, 40000, 8080, 5432, 53}},
+		{"/connections?q=proc:dnsmasq+rport:53", []uint16{40000}},
+		{"/listeners", []uint16{53, 5432, 8080}},
+		{"/listeners?proto=tcp", []uint16{5432, 8080}},
+		{"/listeners?q=!port:8080", []uint16{53, 5432}},
+	}
+	for _, test := range tests {
+		var records []system.ConnectionRecord
+		if code := get(t, handler, test.url, "", &records); code != http.StatusOK {
+			t.Errorf("GET %s: status %d", test.url, code)
+			continue
+		}
+		if ports := localPorts(records); !equalPorts(ports, test.ports) {
+			t.Errorf("GET %s: ports %v, want %v", test.url, ports, test.ports)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	handler := NewServer(system.NewFakeCollector(fakeConnections()), 0, "").Handler()
+
+	var process processResponse
+	if code := get(t, handler, "/processes/400", "", &process); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if process.PID != 400 || !equalPorts(localPorts(process.Connections), []uint16{53, 40000}) {
+		t.Errorf("process = %+v", process)
+	}
+
+	if code := get(t, handler, "/processes/999999", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown process: status %d, want %d", code, http.StatusNotFound)
+	}
+	if code := get(t, handler, "/processes/abc", "", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid pid: status %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	collector := system.NewFakeCollector(fakeConnections())
+	handler := NewServer(collector, 0, "").Handler()
+
+	for _, url := range []string{
+		"/connections?proto=sctp",
+		"/connections?state=OPEN",
+		"/connections?sort=size",
+		"/connections?q=pid:x",
+		"/listeners?q=port:abc",
+	} {
+		var body map[string]string
+		if code := get(t, handler, url, "", &body); code != http.StatusBadRequest || body["error"] == "" {
+			t.Errorf("GET %s: status %d, body %v", url, code, body)
+		}
+	}
+
+	collector.SetError(errors.New("table not readable"))
+	var body map[string]string
+	if code := get(t, handler, "/connections", "", &body); code != http.StatusInternalServerError || body["error"] != "table not readable" {
+		t.Errorf("failing collector: status %d, body %v", code, body)
+	}
+}
+
+func TestToken(t *testing.T) {
+	handler := NewServer(system.NewFakeCollector(fakeConnections()), 0, "secret").Handler()
+
+	for _, token := range []string{"", "wrong"} {
+		if code := get(t, handler, "/connections", token, nil); code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want %d", token, code, http.StatusUnauthorized)
+		}
+	}
+	if code := get(t, handler, "/connections", "secret", nil); code != http.StatusOK {
+		t.Errorf("valid token: status %d", code)
+	}
+}
+
+func TestMetricsRates(t *testing.T) {
+	conns := fakeConnections()
+	collector := system.NewFakeCollector(conns)
+	handler := NewServer(collector, 0, "").Handler()
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	// psql received 1000 bytes between two scrapes
+	conns[2].Stats = &system.ConnectionStats{HasTCPInfo: true, BytesReceived: 5000, BytesAcked: 200}
+	if body := scrape(); strings.Contains(body, `bytes_per_second{process="psql"}`) {
+		t.Errorf("rate after the first scrape:\n%s", body)
+	}
+	time.Sleep(10 * time.Millisecond)
+	conns = fakeConnections()
+	conns[2].Stats = &system.ConnectionStats{HasTCPInfo: true, BytesReceived: 6000, BytesAcked: 200}
+	collector.SetConnections(conns)
+
+	body := scrape()
+	for _, line := range []string{
+		`localports_process_receive_bytes_per_second{process="psql"} `,
+		`localports_process_transmit_bytes_per_second{process="psql"} 0`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `localports_process_receive_bytes_per_second{process="psql"} 0`) {
+		t.Errorf("receive rate of psql is 0:\n%s", body)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/u00io/localports/system"
+)
+
+// DefaultMetricsLabelLimit caps the values of the process and country
+// labels. Less frequent values are summed up under "other".
+const DefaultMetricsLabelLimit = 50
+
+const otherLabelValue = "other"
+
+type metricSample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+type metric struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// SetMetricsLabelLimit changes the cardinality cap of /metrics
+func (c *Server) SetMetricsLabelLimit(limit int) {
+	c.metricsLabelLimit = limit
+}
+
+func (c *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	conns, err := c.snapshot(r, "all", "ALL")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, buildMetrics(conns, c.metricsLabelLimit))
+}
+
+func buildMetrics(conns []system.ConnectionInfo, labelLimit int) []metric {
+	byState := make(map[[2]string]int)
+	byProcess := make(map[string]int)
+	byCountry := make(map[string]int)
+	listening := make(map[[2]string]bool)
+	receiveRates := make(map[string]float64)
+	transmitRates := make(map[string]float64)
+
+	for _, conn := range conns {
+		state := conn.State
+		if state == "" {
+			state = "NONE"
+		}
+		byState[[2]string{conn.Protocol, state}]++
+		byProcess[conn.ProcessName]++
+
+		if conn.State != "LISTEN" {
+			if country, err := system.GetCountryISOCodeByIP(conn.RemoteAddr); err == nil && country != "" {
+				byCountry[country]++
+			}
+		}
+
+		if conn.Protocol != "UNIX" && (conn.State == "LISTEN" || (conn.Protocol == "UDP" && conn.RemotePort == 0)) {
+			listening[[2]string{conn.Protocol, fmt.Sprint(conn.LocalPort)}] = true
+		}
+
+		if conn.Rates != nil {
+			receiveRates[conn.ProcessName] += conn.Rates.InPerSec
+			transmitRates[conn.ProcessName] += conn.Rates.OutPerSec
+		}
+	}
+
+	listeningByProtocol := make(map[string]int)
+	for key := range listening {
+		listeningByProtocol[key[0]]++
+	}
+
+	var result []metric
+
+	m := metric{name: "localports_connections", help: "Number of sockets by protocol and state."}
+	for key, count := range byState {
+		m.samples = append(m.samples, metricSample{labels: []string{"protocol", key[0], "state", key[1]}, value: float64(count)})
+	}
+	result = append(result, m)
+
+	m = metric{name: "localports_connections_by_process", help: "Number of sockets by process name."}
+	for name, count := range capLabelValues(byProcess, labelLimit) {
+		m.samples = append(m.samples, metricSample{labels: []string{"process", name}, value: float64(count)})
+	}
+	result = append(result, m)
+
+	m = metric{name: "localports_connections_by_country", help: "Number of connections by country (ISO code) of the remote address."}
+	for country, count := range capLabelValues(byCountry, labelLimit) {
+		m.samples = append(m.samples, metricSample{labels: []string{"country", country}, value: float64(count)})
+	}
+	result = append(result, m)
+
+	m = metric{name: "localports_listening_ports", help: "Number of distinct local ports with a listening TCP or unconnected UDP socket."}
+	for _, protocol := range []string{"TCP", "UDP"} {
+		m.samples = append(m.samples, metricSample{labels: []string{"protocol", protocol}, value: float64(listeningByProtocol[protocol])})
+	}
+	result = append(result, m)
+
+	m = metric{name: "localports_process_receive_bytes_per_second", help: "Receive rate of the TCP connections by process name, measured since the previous scrape."}
+	for name, rate := range capLabelValues(receiveRates, labelLimit) {
+		m.samples = append(m.samples, metricSample{labels: []string{"process", name}, value: rate})
+	}
+	result = append(result, m)
+
+	m = metric{name: "localports_process_transmit_bytes_per_second", help: "Transmit rate of the TCP connections by process name, measured since the previous scrape."}
+	for name, rate := range capLabelValues(transmitRates, labelLimit) {
+		m.samples = append(m.samples, metricSample{labels: []string{"process", name}, value: rate})
+	}
+	result = append(result, m)
+
+	return result
+}
+
+// capLabelValues keeps the limit-1 largest values and sums up the rest
+// under "other", so the number of series never exceeds limit
+func capLabelValues[T int | float64](counts map[string]T, limit int) map[string]T {
+	if limit <= 0 || len(counts) <= limit {
+		return counts
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	result := make(map[string]T)
+	for i, name := range names {
+		if i < limit-1 && name != otherLabelValue {
+			result[name] = counts[name]
+		} else {
+			result[otherLabelValue] += counts[name]
+		}
+	}
+	return result
+}
+
+func writeMetrics(w io.Writer, metrics []metric) {
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+
+		lines := make([]string, 0, len(m.samples))
+		for _, sample := range m.samples {
+			labels := make([]string, 0, len(sample.labels)/2)
+			for i := 0; i+1 < len(sample.labels); i += 2 {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", sample.labels[i], escapeLabelValue(sample.labels[i+1])))
+			}
+			lines = append(lines, fmt.Sprintf("%s{%s} %s", m.name, strings.Join(labels, ","), strconv.FormatFloat(sample.value, 'g', -1, 64)))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
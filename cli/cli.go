@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/u00io/localports/system"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"list", "print connections and listening ports", runList},
+		{"history", "query recorded connection lifetimes", runHistory},
+		{"serve", "serve the HTTP API without the window", runServe},
+		{"kill", "terminate the process holding a port", runKill},
+		{"help", "show this help", runHelp},
+	}
+}
+
+// IsCommand reports whether the command line asks for headless mode
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "-h" || args[0] == "--help" {
+		return true
+	}
+	_, ok := findCommand(args[0])
+	return ok
+}
+
+// Run executes a headless command and returns the exit code
+func Run(args []string) int {
+	attachConsole()
+
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return 2
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		if args[0] == "-h" || args[0] == "--help" {
+			printUsage(os.Stdout)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+	return cmd.run(args[1:])
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func runHelp(args []string) int {
+	printUsage(os.Stdout)
+	return 0
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: localports [command] [options]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command the graphical interface is started.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'localports <command> -h' for the options of a command.")
+}
+
+// initSystem prepares the process list that the collectors use for names
+func initSystem() {
+	if system.Instance == nil {
+		system.Instance = system.NewSystem()
+	}
+	system.Instance.UpdateProcesses()
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package cli
+
+func attachConsole() {
+}
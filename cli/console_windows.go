@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32       = windows.NewLazySystemDLL("kernel32.dll")
+	procAttachConsole = modkernel32.NewProc("AttachConsole")
+)
+
+const ATTACH_PARENT_PROCESS = ^uintptr(0)
+
+// attachConsole connects the output to the console of the parent shell.
+// The release build is linked with -H windowsgui and has no console.
+func attachConsole() {
+	ret, _, _ := procAttachConsole.Call(ATTACH_PARENT_PROCESS)
+	if ret == 0 {
+		return
+	}
+	if f, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout = f
+		os.Stderr = f
+	}
+	if f, err := os.OpenFile("CONIN$", os.O_RDONLY, 0); err == nil {
+		os.Stdin = f
+	}
+}
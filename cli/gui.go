@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/u00io/localports/system"
+)
+
+// GUIFlags are the options accepted when the window is started
+type GUIFlags struct {
+	APIPort      int
+	APIToken     string
+	Collector    string
+	DockerSocket string
+	Config       string
+
+	// Filter of the table, applied by the running window when forwarded
+	Port  int
+	Proto string
+	State string
+	Query string
+}
+
+// ParseGUIFlags parses the command line of the window. Errors are also
+// printed, with the usage for unknown flags.
+func ParseGUIFlags(args []string) (GUIFlags, error) {
+	var result GUIFlags
+	fs := flag.NewFlagSet("localports", flag.ContinueOnError)
+	fs.IntVar(&result.APIPort, "api-port", 0, "also serve the HTTP API on this port of 127.0.0.1")
+	fs.StringVar(&result.APIToken, "api-token", os.Getenv("LOCALPORTS_API_TOKEN"), "bearer token required by the HTTP API")
+	fs.StringVar(&result.Collector, "collector", "", "connection source: "+strings.Join(system.CollectorNames(), ", ")+" (default $LOCALPORTS_COLLECTOR)")
+	fs.StringVar(&result.DockerSocket, "docker-socket", "", "name containers through the Docker API on this socket, e.g. "+system.DefaultDockerSocket)
+	fs.StringVar(&result.Config, "config", "", "settings file (default $LOCALPORTS_CONFIG or settings.json in the data directory)")
+	fs.IntVar(&result.Port, "port", 0, "show the sockets of this port")
+	fs.StringVar(&result.Proto, "proto", "", "protocol: tcp, udp, unix or all")
+	fs.StringVar(&result.State, "state", "", "TCP state: LISTEN, ESTABLISHED, OTHER or ALL")
+	fs.StringVar(&result.Query, "query", "", "search, e.g. \"port:5432 proc:postgres\"")
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	result.Proto = strings.ToLower(result.Proto)
+	result.State = strings.ToUpper(result.State)
+	var err error
+	switch {
+	case result.Port < 0 || result.Port > 65535:
+		err = fmt.Errorf("invalid port: %d", result.Port)
+	case result.Proto != "" && !slices.Contains(system.FilterTypes, result.Proto):
+		err = fmt.Errorf("invalid protocol: %s", result.Proto)
+	case result.State != "" && !slices.Contains(system.FilterStatuses, result.State):
+		err = fmt.Errorf("invalid state: %s", result.State)
+	default:
+		_, err = system.ParseQuery(result.Query)
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+	}
+	return result, err
+}
+
+// Filter returns the filter given on the command line. Fields that were
+// not given are empty; the port becomes a port: term of the query.
+func (f GUIFlags) Filter() (system.FilterPreset, bool) {
+	filter := system.FilterPreset{
+		Type:   f.Proto,
+		Status: f.State,
+		Query:  f.Query,
+	}
+	if f.Port != 0 {
+		filter.Query = strings.TrimSpace(fmt.Sprintf("port:%d %s", f.Port, f.Query))
+	}
+	return filter, filter.Type != "" || filter.Status != "" || filter.Query != ""
+}
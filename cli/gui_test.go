@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/u00io/localports/system"
+)
+
+func TestParseGUIFlags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		filter system.FilterPreset
+		ok     bool
+	}{
+		{nil, system.FilterPreset{}, false},
+		{[]string{"--api-port", "8080"}, system.FilterPreset{}, false},
+		{[]string{"--port", "5432"}, system.FilterPreset{Query: "port:5432"}, true},
+		{[]string{"--port", "80", "--query", "proc:nginx"}, system.FilterPreset{Query: "port:80 proc:nginx"}, true},
+		{[]string{"--proto", "UDP", "--state", "all"}, system.FilterPreset{Type: "udp", Status: "ALL"}, true},
+	}
+	for _, test := range tests {
+		flags, err := ParseGUIFlags(test.args)
+		if err != nil {
+			t.Errorf("ParseGUIFlags(%v): %v", test.args, err)
+			continue
+		}
+		filter, ok := flags.Filter()
+		if ok != test.ok || filter.Type != test.filter.Type || filter.Status != test.filter.Status || filter.Query != test.filter.Query {
+			t.Errorf("ParseGUIFlags(%v).Filter() = %+v, %v, want %+v, %v", test.args, filter, ok, test.filter, test.ok)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--port", "70000"},
+		{"--proto", "sctp"},
+		{"--state", "OPEN"},
+		{"--query", "port:abc"},
+		{"--unknown"},
+	} {
+		if _, err := ParseGUIFlags(args); err == nil {
+			t.Errorf("ParseGUIFlags(%v) succeeded", args)
+		}
+	}
+}
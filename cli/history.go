@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/u00io/localports/system"
+)
+
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	from := fs.String("from", "", "start of the time range (2006-01-02, 2006-01-02T15:04, 15:04 or RFC 3339)")
+	to := fs.String("to", "", "end of the time range, same formats as --from")
+	last := fs.Duration("last", 0, "time range ending now, e.g. 2h, instead of --from")
+	port := fs.Uint("port", 0, "local or remote port")
+	proc := fs.String("proc", "", "part of the program name")
+	remote := fs.String("remote", "", "remote address or CIDR prefix, e.g. 10.0.0.0/8")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *last != 0 && *from != "" {
+		fmt.Fprintln(os.Stderr, "--last and --from cannot be combined")
+		return 2
+	}
+
+	var q system.HistoryQuery
+	var err error
+	if q.From, err = parseTime(*from); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --from: %s\n", *from)
+		return 2
+	}
+	if q.To, err = parseTime(*to); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --to: %s\n", *to)
+		return 2
+	}
+	if *last > 0 {
+		q.From = time.Now().Add(-*last)
+	}
+	if *port > 65535 {
+		fmt.Fprintf(os.Stderr, "invalid port: %d\n", *port)
+		return 2
+	}
+	q.Port = uint16(*port)
+	q.Process = *proc
+	q.Remote = *remote
+
+	writer, ok := historyWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid format: %s\n", *format)
+		return 2
+	}
+
+	lifetimes, err := system.QueryHistory(system.HistoryDir(), q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if err := writer(os.Stdout, lifetimes); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseTime accepts a few human formats in local time. A time of day
+// alone refers to today.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+var historyWriters = map[string]func(w io.Writer, lifetimes []system.ConnectionLifetime) error{
+	"table": writeHistoryTable,
+	"json":  writeHistoryJSON,
+	"csv":   writeHistoryCSV,
+}
+
+func writeHistoryJSON(w io.Writer, lifetimes []system.ConnectionLifetime) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lifetimes)
+}
+
+func historyFields(l system.ConnectionLifetime) []string {
+	remotePort := ""
+	if l.RemotePort > 0 {
+		remotePort = strconv.FormatUint(uint64(l.RemotePort), 10)
+	}
+	return []string{
+		l.FirstSeen.Format(time.RFC3339),
+		l.LastSeen.Format(time.RFC3339),
+		l.Protocol,
+		l.LocalAddress,
+		strconv.FormatUint(uint64(l.LocalPort), 10),
+		l.RemoteAddress,
+		remotePort,
+		l.State,
+		strconv.FormatUint(uint64(l.PID), 10),
+		l.Program,
+		l.Country,
+		strconv.FormatBool(l.Open),
+	}
+}
+
+func writeHistoryCSV(w io.Writer, lifetimes []system.ConnectionLifetime) error {
+	cw := csv.NewWriter(w)
+	header := []string{"first_seen", "last_seen", "protocol", "local_address", "local_port", "remote_address", "remote_port", "state", "pid", "program", "country", "open"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, l := range lifetimes {
+		if err := cw.Write(historyFields(l)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeHistoryTable(w io.Writer, lifetimes []system.ConnectionLifetime) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"FIRST SEEN", "LAST SEEN", "TYPE", "LOCAL", "REMOTE", "STATUS", "PID", "PROGRAM", "COUNTRY"}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, l := range lifetimes {
+		remote := ""
+		if l.RemoteAddress != "" && l.State != "LISTEN" {
+			remote = system.FormatEndpoint(l.RemoteAddress, l.RemotePort)
+		}
+		lastSeen := l.LastSeen.Format("2006-01-02 15:04:05")
+		if l.Open {
+			lastSeen = "open"
+		}
+		fields := []string{
+			l.FirstSeen.Format("2006-01-02 15:04:05"),
+			lastSeen,
+			l.Protocol,
+			system.FormatEndpoint(l.LocalAddress, l.LocalPort),
+			remote,
+			l.State,
+			fmt.Sprintf("%d", l.PID),
+			l.Program,
+			l.Country,
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
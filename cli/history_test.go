@@ -0,0 +1,17 @@
+package cli
+
+import "testing"
+
+func TestHistoryErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--last", "2h", "--from", "03:00"},
+		{"--from", "yesterday"},
+		{"--to", "25:00"},
+		{"--port", "70000"},
+		{"--format", "xml"},
+	} {
+		if code := runHistory(args); code != 2 {
+			t.Errorf("history %v: exit code %d, want 2", args, code)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/u00io/localports/system"
+)
+
+func runKill(args []string) int {
+	fs := flag.NewFlagSet("kill", flag.ContinueOnError)
+	signalName := fs.String("signal", "TERM", "signal: "+strings.Join(system.KillSignals, ", "))
+	timeout := fs.Duration("timeout", system.DefaultKillTimeout, "send KILL when TERM did not end the process within this time, 0 to never")
+	proto := fs.String("proto", "all", "protocol: tcp, udp or all")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	collectorName := fs.String("collector", "", "connection source: "+strings.Join(system.CollectorNames(), ", ")+" (default $LOCALPORTS_COLLECTOR)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: localports kill [options] [ADDRESS]:PORT")
+		fs.PrintDefaults()
+	}
+
+	// Options may also follow the target: kill :3000 --signal KILL
+	var targets []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		targets = append(targets, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(targets) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	addr, port, err := parsePortTarget(targets[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	signal, err := system.ParseSignal(*signalName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	filterType := strings.ToLower(*proto)
+	if filterType != "tcp" && filterType != "udp" && filterType != "all" {
+		fmt.Fprintf(os.Stderr, "invalid protocol: %s\n", *proto)
+		return 2
+	}
+
+	collector, err := system.SelectCollector(*collectorName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	initSystem()
+	conns, err := system.SnapshotFiltered(context.Background(), collector, filterType, "ALL")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	owners := portOwners(conns, addr, port)
+	if len(owners) == 0 {
+		fmt.Fprintf(os.Stderr, "no process holds %s\n", targets[0])
+		return 1
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	exitCode := 0
+	for _, conn := range owners {
+		if conn.PID == 0 {
+			fmt.Fprintf(os.Stderr, "the owner of %s is unknown, run as root to see processes of other users\n", describeSocket(conn))
+			exitCode = 1
+			continue
+		}
+		process := conn.Process
+		if err := system.CheckKillable(process); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		if !*yes && !confirm(stdin, os.Stderr, fmt.Sprintf("Send %s to %s (PID %d%s), holding %s?", signal, process.Name, process.PID, userSuffix(process), describeSocket(conn))) {
+			fmt.Fprintln(os.Stderr, "skipped")
+			continue
+		}
+
+		result, err := system.KillProcess(process, signal, *timeout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		switch {
+		case result.Escalated && result.Exited:
+			fmt.Fprintf(os.Stderr, "%s (PID %d) ignored TERM and was killed\n", process.Name, process.PID)
+		case result.Exited:
+			fmt.Fprintf(os.Stderr, "%s (PID %d) exited after %s\n", process.Name, process.PID, result.Signal)
+		default:
+			fmt.Fprintf(os.Stderr, "sent %s to %s (PID %d), it is still running\n", result.Signal, process.Name, process.PID)
+		}
+	}
+	return exitCode
+}
+
+// portOwners returns one socket per process that holds the port. Listening
+// and unconnected sockets are preferred; when there are none, processes
+// with a connection from that local port are returned.
+func portOwners(conns []system.ConnectionInfo, addr string, port uint16) []system.ConnectionInfo {
+	var listeners, others []system.ConnectionInfo
+	seenListeners := make(map[uint32]bool)
+	seenOthers := make(map[uint32]bool)
+	for _, conn := range conns {
+		if conn.Protocol == "UNIX" || conn.LocalPort != port {
+			continue
+		}
+		if addr != "" && !sameAddress(addr, conn.LocalAddr) {
+			continue
+		}
+		if conn.State == "LISTEN" || (conn.Protocol == "UDP" && conn.RemotePort == 0) {
+			if !seenListeners[conn.PID] {
+				seenListeners[conn.PID] = true
+				listeners = append(listeners, conn)
+			}
+		} else if !seenOthers[conn.PID] {
+			seenOthers[conn.PID] = true
+			others = append(others, conn)
+		}
+	}
+	if len(listeners) > 0 {
+		return listeners
+	}
+	return others
+}
+
+func sameAddress(a string, b string) bool {
+	addrA, errA := netip.ParseAddr(a)
+	addrB, errB := netip.ParseAddr(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return addrA.Unmap().WithZone("") == addrB.Unmap().WithZone("")
+}
+
+// parsePortTarget parses "3000", ":3000", "127.0.0.1:3000" or "[::1]:3000"
+func parsePortTarget(target string) (string, uint16, error) {
+	addr := ""
+	portText := target
+	if index := strings.LastIndex(target, ":"); index >= 0 {
+		addr = strings.Trim(target[:index], "[]")
+		portText = target[index+1:]
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, fmt.Errorf("invalid port: %s", target)
+	}
+	if addr != "" {
+		if _, err := netip.ParseAddr(addr); err != nil {
+			return "", 0, fmt.Errorf("invalid address: %s", addr)
+		}
+	}
+	return addr, uint16(port), nil
+}
+
+func describeSocket(conn system.ConnectionInfo) string {
+	text := conn.Protocol + " " + system.FormatEndpoint(conn.LocalAddr, conn.LocalPort)
+	if conn.State != "" && conn.State != "LISTEN" {
+		text += " (" + conn.State + ")"
+	}
+	return text
+}
+
+func userSuffix(p system.ProcessInfo) string {
+	if p.User == "" {
+		return ""
+	}
+	return ", user " + p.User
+}
+
+// confirm asks a yes/no question, anything but y or yes is a no
+func confirm(in *bufio.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return slices.Contains([]string{"y", "yes"}, answer)
+}
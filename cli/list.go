@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/u00io/localports/system"
+)
+
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	proto := fs.String("proto", "tcp", "protocol: tcp, udp, unix or all")
+	state := fs.String("state", "LISTEN", "TCP state: LISTEN, ESTABLISHED, OTHER or ALL")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	sortColumn := fs.String("sort", system.ColumnLocalPort, "sort column: "+strings.Join(system.SortColumns, ", "))
+	desc := fs.Bool("desc", false, "sort in descending order")
+	container := fs.String("container", "", "only sockets of processes whose container, pod or systemd unit contains this text")
+	netns := fs.String("netns", system.NamespaceAll, "network namespace: all, host, other, an \"ip netns\" name or an inode")
+	query := fs.String("query", "", "search, e.g. \"port:5432 proc:postgres !state:TIME_WAIT\"; keys: "+strings.Join(system.QueryKeys(), ", "))
+	dockerSocket := fs.String("docker-socket", "", "name containers through the Docker API on this socket, e.g. "+system.DefaultDockerSocket)
+	rateInterval := fs.Duration("rates", 0, "measure transfer rates over this interval, e.g. 2s (netlink collector only)")
+	collectorName := fs.String("collector", "", "connection source: "+strings.Join(system.CollectorNames(), ", ")+" (default $LOCALPORTS_COLLECTOR)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filterType := strings.ToLower(*proto)
+	if !slices.Contains(system.FilterTypes, filterType) {
+		fmt.Fprintf(os.Stderr, "invalid protocol: %s\n", *proto)
+		return 2
+	}
+	filterStatus := strings.ToUpper(*state)
+	if !slices.Contains(system.FilterStatuses, filterStatus) {
+		fmt.Fprintf(os.Stderr, "invalid state: %s\n", *state)
+		return 2
+	}
+	if !slices.Contains(system.SortColumns, *sortColumn) {
+		fmt.Fprintf(os.Stderr, "invalid sort column: %s\n", *sortColumn)
+		return 2
+	}
+	search, err := system.ParseQuery(*query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	writer, ok := outputWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid format: %s\n", *format)
+		return 2
+	}
+
+	collector, err := system.SelectCollector(*collectorName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	initSystem()
+	system.SetDockerSocket(*dockerSocket)
+
+	var conns []system.ConnectionInfo
+	if *rateInterval > 0 {
+		conns, err = measureRates(collector, filterType, filterStatus, *rateInterval)
+	} else {
+		conns, err = system.SnapshotFiltered(context.Background(), collector, filterType, filterStatus)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	conns = system.FilterContainer(conns, *container)
+	conns = system.FilterNamespace(conns, *netns)
+	conns = system.FilterQuery(conns, search)
+	system.SortConnections(conns, *sortColumn, !*desc)
+
+	if err := writer(os.Stdout, system.NewConnectionRecords(conns)); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// measureRates takes two snapshots interval apart and returns the second
+// one with the transfer rates filled in
+func measureRates(collector system.Collector, filterType string, filterStatus string, interval time.Duration) ([]system.ConnectionInfo, error) {
+	meter := system.NewRateMeter()
+	first, err := system.SnapshotFiltered(context.Background(), collector, filterType, filterStatus)
+	if err != nil {
+		return nil, err
+	}
+	meter.Update(first, time.Now())
+
+	time.Sleep(interval)
+
+	conns, err := system.SnapshotFiltered(context.Background(), collector, filterType, filterStatus)
+	if err != nil {
+		return nil, err
+	}
+	meter.Update(conns, time.Now())
+	return conns, nil
+}
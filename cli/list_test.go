@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/u00io/localports/system"
+)
+
+var fakeCollector = system.NewFakeCollector(nil)
+
+func init() {
+	system.RegisterCollector("fake", func() system.Collector { return fakeCollector })
+}
+
+func fakeConnections() []system.ConnectionInfo {
+	return []system.ConnectionInfo{
+		{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 8080, RemoteAddr: "0.0.0.0", State: "LISTEN", PID: 100, ProcessName: "nginx"},
+		{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 5432, RemoteAddr: "0.0.0.0", State: "LISTEN", PID: 200, ProcessName: "postgres"},
+		{Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: 50000, RemoteAddr: "10.0.0.9", RemotePort: 5432, State: "ESTABLISHED", PID: 300, ProcessName: "psql"},
+		{Protocol: "UDP", LocalAddr: "0.0.0.0", LocalPort: 53, PID: 400, ProcessName: "dnsmasq"},
+		{Protocol: "UNIX", SocketType: "STREAM", LocalAddr: "/run/app.sock", State: "LISTEN", PID: 100, ProcessName: "nginx"},
+	}
+}
+
+// runListCaptured runs the list command and returns the exit code and
+// what it printed on stdout
+func runListCaptured(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	stdout := os.Stdout
+	os.Stdout = out
+	code := runList(append([]string{"--collector", "fake"}, args...))
+	os.Stdout = stdout
+
+	out.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(data)
+}
+
+func TestList(t *testing.T) {
+	fakeCollector.SetError(nil)
+	fakeCollector.SetConnections(fakeConnections())
+
+	tests := []struct {
+		name  string
+		args  []string
+		ports []uint16
+	}{
+		{"defaults are TCP listeners", nil, []uint16{5432, 8080}},
+		{"all sockets", []string{"--proto", "all", "--state", "ALL"}, []uint16{0, 53, 5432, 8080, 50000}},
+		{"UDP", []string{"--proto", "udp", "--state", "ALL"}, []uint16{53}},
+		{"established", []string{"--state", "established"}, []uint16{50000}},
+		{"descending", []string{"--desc"}, []uint16{8080, 5432}},
+		{"query", []string{"--proto", "all", "--state", "ALL", "--query", "proc:nginx"}, []uint16{0, 8080}},
+		{"negated query", []string{"--query", "!port:8080"}, []uint16{5432}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out := runListCaptured(t, append(test.args, "--format", "json")...)
+			if code != 0 {
+				t.Fatalf("exit code %d", code)
+			}
+			var records []system.ConnectionRecord
+			if err := json.Unmarshal([]byte(out), &records); err != nil {
+				t.Fatalf("%v in %q", err, out)
+			}
+			var ports []uint16
+			for _, record := range records {
+				ports = append(ports, record.LocalPort)
+			}
+			if len(ports) != len(test.ports) {
+				t.Fatalf("ports %v, want %v", ports, test.ports)
+			}
+			for i := range ports {
+				if ports[i] != test.ports[i] {
+					t.Fatalf("ports %v, want %v", ports, test.ports)
+				}
+			}
+		})
+	}
+}
+
+func TestListRecord(t *testing.T) {
+	fakeCollector.SetError(nil)
+	fakeCollector.SetConnections(fakeConnections())
+
+	_, out := runListCaptured(t, "--query", "port:5432", "--format", "json")
+	var records []system.ConnectionRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r.Protocol != "TCP" || r.LocalAddress != "127.0.0.1" || r.State != "LISTEN" || r.PID != 200 || r.Program != "postgres" {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	fakeCollector.SetConnections(fakeConnections())
+
+	for _, args := range [][]string{
+		{"--proto", "sctp"},
+		{"--state", "OPEN"},
+		{"--sort", "size"},
+		{"--format", "xml"},
+		{"--query", "port:abc"},
+	} {
+		if code, _ := runListCaptured(t, args...); code != 2 {
+			t.Errorf("list %v: exit code %d, want 2", args, code)
+		}
+	}
+
+	fakeCollector.SetError(errors.New("table not readable"))
+	defer fakeCollector.SetError(nil)
+	if code, out := runListCaptured(t); code != 1 || out != "" {
+		t.Errorf("failing collector: exit code %d, output %q", code, out)
+	}
+}
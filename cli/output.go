@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/u00io/localports/system"
+)
+
+var outputWriters = map[string]func(w io.Writer, records []system.ConnectionRecord) error{
+	"table": writeTable,
+	"json":  writeJSON,
+	"csv":   writeCSV,
+}
+
+func writeJSON(w io.Writer, records []system.ConnectionRecord) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+func writeCSV(w io.Writer, records []system.ConnectionRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(system.RecordHeader()); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := cw.Write(r.Fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTable(w io.Writer, records []system.ConnectionRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"TYPE", "LOCAL ADDRESS", "LOCAL PORT", "REMOTE ADDRESS", "REMOTE PORT", "STATUS", "PID", "PROGRAM", "SERVICE", "COUNTRY"}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range records {
+		protocol := r.Protocol
+		localPort := fmt.Sprintf("%d", r.LocalPort)
+		if r.Protocol == "UNIX" {
+			protocol = "UNIX/" + r.SocketType
+			localPort = ""
+		}
+		program := r.Program
+		if r.SocketUnit != "" {
+			program += " (" + r.SocketUnit + ")"
+		}
+		remotePort := ""
+		if r.RemotePort > 0 {
+			remotePort = fmt.Sprintf("%d", r.RemotePort)
+		}
+		fields := []string{
+			protocol,
+			system.FormatAddress(r.LocalAddress),
+			localPort,
+			system.FormatAddress(r.RemoteAddress),
+			remotePort,
+			r.State,
+			fmt.Sprintf("%d", r.PID),
+			program,
+			r.Service,
+			r.Country,
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/u00io/localports/api"
+	"github.com/u00io/localports/system"
+)
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.Int("port", api.DefaultPort, "port on 127.0.0.1")
+	token := fs.String("token", os.Getenv("LOCALPORTS_API_TOKEN"), "bearer token required by the API (default $LOCALPORTS_API_TOKEN)")
+	labelLimit := fs.Int("metrics-label-limit", api.DefaultMetricsLabelLimit, "maximum number of process and country label values in /metrics")
+	collectorName := fs.String("collector", "", "connection source: "+strings.Join(system.CollectorNames(), ", ")+" (default $LOCALPORTS_COLLECTOR)")
+	dockerSocket := fs.String("docker-socket", "", "name containers through the Docker API on this socket, e.g. "+system.DefaultDockerSocket)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	collector, err := system.SelectCollector(*collectorName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	system.Instance = system.NewSystem()
+	system.Instance.UpdateProcesses()
+	system.Instance.Start()
+	system.SetDockerSocket(*dockerSocket)
+
+	server := api.NewServer(collector, *port, *token)
+	server.SetMetricsLabelLimit(*labelLimit)
+	if err := server.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "serving on http://%s\n", server.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	server.Stop()
+	return 0
+}
@@ -1,10 +1,16 @@
 package bottompanel
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/u00io/localports/system"
 	"github.com/u00io/nuiforms/ui"
 )
 
+// topProcessCount is the number of processes in the traffic summary
+const topProcessCount = 3
+
 type BottomPanel struct {
 	ui.Widget
 }
@@ -14,6 +20,7 @@ func NewBottomPanel() *BottomPanel {
 	c.InitWidget()
 	c.SetLayout(`
 		<row>
+			<label id="lblRates" text="" />
 			<hspacer />
 			<button text="About" onclick="OnAboutClicked" />
 		</row>
@@ -24,6 +31,32 @@ func NewBottomPanel() *BottomPanel {
 }
 
 func (c *BottomPanel) HandleSystemEvent(event system.Event) {
+	if event.Name == "update" {
+		c.updateRates()
+	}
+}
+
+// updateRates shows the processes with the highest transfer rates
+func (c *BottomPanel) updateRates() {
+	lblRates, ok := c.FindWidgetByName("lblRates").(*ui.Label)
+	if !ok {
+		return
+	}
+
+	rates := system.Instance.GetProcessRates()
+	if len(rates) > topProcessCount {
+		rates = rates[:topProcessCount]
+	}
+	parts := make([]string, 0, len(rates))
+	for _, p := range rates {
+		parts = append(parts, fmt.Sprintf("%s (%d): in %s, out %s",
+			p.ProcessName, p.PID, system.FormatRate(p.InPerSec), system.FormatRate(p.OutPerSec)))
+	}
+	if len(parts) == 0 {
+		lblRates.SetText("")
+		return
+	}
+	lblRates.SetText("Traffic: " + strings.Join(parts, "   |   "))
 }
 
 func (c *BottomPanel) OnAboutClicked() {
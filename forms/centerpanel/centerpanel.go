@@ -1,13 +1,16 @@
 package centerpanel
 
 import (
+	"context"
 	"fmt"
+	"image"
 	"image/color"
-	"sort"
 	"sync"
 	"time"
 
+	"github.com/u00io/gomisc/logger"
 	"github.com/u00io/localports/flags"
+	"github.com/u00io/localports/settings"
 	"github.com/u00io/localports/system"
 	"github.com/u00io/nuiforms/ui"
 )
@@ -15,57 +18,67 @@ import (
 type CenterPanel struct {
 	ui.Widget
 
-	mtx  sync.Mutex
-	data system.NetworkConnections
+	collector system.Collector
 
-	orderColumnIndex int
-	orderAsc         bool
+	mtx         sync.Mutex
+	data        system.NetworkConnections
+	dataVersion int
+
+	shownVersion int
+	highlighter  *rowHighlighter
+
+	rows        []tableRow
+	selectedKey *system.ConnectionKey
+	groupBy     string
+	pendingKill *pendingKill
+	collapsed   map[string]bool // Keys of the collapsed groups
+
+	columns       []tableColumn
+	columnWidths  map[string]int // From the settings, by column key
+	resizedWidths map[string]int // Dragged by the user, not saved yet
+	resizedAt     time.Time
+	orderColumn   string
+	orderAsc      bool
 
 	tableResults *ui.Table
 }
 
-func NewCenterPanel() *CenterPanel {
+func NewCenterPanel(collector system.Collector) *CenterPanel {
 	var c CenterPanel
 	c.InitWidget()
+	c.collector = collector
 	c.tableResults = ui.NewTable()
 	curstomWidgets := map[string]ui.Widgeter{
 		"tableresults": c.tableResults,
 	}
 	c.SetLayout(`
-		<row>
-			<widget id="tableresults" />
-		</row>
+		<column>
+			<row>
+				<widget id="tableresults" />
+			</row>
+			<row>
+				<label id="lblDetails" text="" />
+				<hspacer />
+				<label id="lblKill" text="" />
+				<button id="btnTerminate" text="Terminate" onclick="OnTerminateClick" />
+				<button id="btnKill" text="Kill" onclick="OnKillClick" />
+				<button id="btnKillCancel" text="Cancel" onclick="OnKillCancelClick" />
+			</row>
+		</column>
 	`, &c, curstomWidgets)
 
-	c.orderColumnIndex = 1
-
-	// c.tableResults
-
-	c.tableResults.SetColumnCount(10)
-	c.tableResults.SetColumnName(0, "Type")
-	c.tableResults.SetColumnName(1, "Local Port")
-	c.tableResults.SetColumnName(2, "Local Address")
-	c.tableResults.SetColumnName(3, "Remote Address")
-	c.tableResults.SetColumnName(4, "Remote Port")
-	c.tableResults.SetColumnName(5, "Status")
-	c.tableResults.SetColumnName(6, "PID")
-	c.tableResults.SetColumnName(7, "Program")
-	c.tableResults.SetColumnName(8, "Service")
-	c.tableResults.SetColumnName(9, "Country")
-
-	c.tableResults.SetColumnWidth(0, 120)
-	c.tableResults.SetColumnWidth(1, 160)
-	c.tableResults.SetColumnWidth(2, 220)
-	c.tableResults.SetColumnWidth(3, 220)
-	c.tableResults.SetColumnWidth(4, 160)
-	c.tableResults.SetColumnWidth(5, 160)
-	c.tableResults.SetColumnWidth(6, 80)
-	c.tableResults.SetColumnWidth(7, 220)
-	c.tableResults.SetColumnWidth(8, 220)
-	c.tableResults.SetColumnWidth(9, 180)
+	c.collapsed = make(map[string]bool)
+	c.columns = defaultColumns()
+	c.orderColumn = system.ColumnLocalPort
+	c.orderAsc = true
+	c.highlighter = newRowHighlighter()
 
 	c.tableResults.SetOnColumnClick(c.OnColumnHeaderClicked)
-	c.updateColumns()
+	c.tableResults.SetOnColumnResize(c.OnColumnResized)
+	c.tableResults.SetOnSelectionChanged(c.OnSelectionChanged)
+	c.applySettings(settings.Get(), true)
+
+	c.AddTimer(250, func() { c.SaveColumnWidths(false) })
 
 	go c.thUpdateData()
 
@@ -74,11 +87,18 @@ func NewCenterPanel() *CenterPanel {
 
 func (c *CenterPanel) thUpdateData() {
 	for {
-		conns := system.GetAllConnections()
+		conns, err := c.collector.Snapshot(context.Background())
+		if err != nil {
+			logger.Println("snapshot error:", err)
+			time.Sleep(settings.Get().RefreshInterval())
+			continue
+		}
+		system.Instance.ProcessSnapshot(conns)
 		c.mtx.Lock()
 		c.data = conns
+		c.dataVersion++
 		c.mtx.Unlock()
-		time.Sleep(1 * time.Second)
+		time.Sleep(settings.Get().RefreshInterval())
 	}
 }
 
@@ -86,49 +106,50 @@ func (c *CenterPanel) HandleSystemEvent(event system.Event) {
 	if event.Name == "update" {
 		c.updateData()
 	}
-}
-
-func (c *CenterPanel) ColumnName(index int) string {
-	switch index {
-	case 0:
-		return "Type"
-	case 1:
-		return "Local Port"
-	case 2:
-		return "Local Address"
-	case 3:
-		return "Remote Address"
-	case 4:
-		return "Remote Port"
-	case 5:
-		return "Status"
-	case 6:
-		return "PID"
-	case 7:
-		return "Program"
-	case 8:
-		return "Service"
-	default:
-		return ""
+	if event.Name == "show_stats" {
+		c.SetStatsVisible(event.Parameter == "1")
+	}
+	if event.Name == "group_by" {
+		c.SetGroupBy(event.Parameter)
+	}
+	if event.Name == "kill_result" {
+		c.setKillText(event.Parameter)
+	}
+	if event.Name == "settings" {
+		c.applySettings(settings.Get(), false)
+		c.updateData()
+	}
+	if event.Name == "netns" {
+		// The namespace is only worth a column when several are shown
+		c.SetColumnVisible(system.ColumnNetNS, event.Parameter != system.NamespaceHost)
 	}
 }
 
 func (c *CenterPanel) OnColumnHeaderClicked(index int) {
-	if c.orderColumnIndex == index {
+	columns := c.visibleColumns()
+	if index < 0 || index >= len(columns) {
+		return
+	}
+	key := columns[index].key
+	if c.orderColumn == key {
 		c.orderAsc = !c.orderAsc
 	} else {
-		c.orderColumnIndex = index
+		c.orderColumn = key
 		c.orderAsc = true
 	}
+	c.saveSort()
 	c.updateColumns()
 	c.updateData()
 }
 
+// updateColumns passes the visible columns to the table and marks the
+// sort column
 func (c *CenterPanel) updateColumns() {
-	// set columns names based on sorting
-	for i := 0; i < 9; i++ {
-		name := c.ColumnName(i)
-		if i == c.orderColumnIndex {
+	columns := c.visibleColumns()
+	c.tableResults.SetColumnCount(len(columns))
+	for i, column := range columns {
+		name := column.name
+		if column.key == c.orderColumn {
 			if c.orderAsc {
 				name = name + " [^]"
 			} else {
@@ -136,177 +157,134 @@ func (c *CenterPanel) updateColumns() {
 			}
 		}
 		c.tableResults.SetColumnName(i, name)
+		c.tableResults.SetColumnWidth(i, c.columnWidth(column))
 	}
 }
 
 func (c *CenterPanel) updateData() {
-	conns := make([]system.ConnectionInfo, 0)
+	c.mtx.Lock()
+	data := c.data
+	dataVersion := c.dataVersion
+	c.mtx.Unlock()
+
+	now := time.Now()
+	if dataVersion != c.shownVersion {
+		c.shownVersion = dataVersion
+		c.highlighter.update(data.Connections, now)
+	}
+	c.highlighter.expire(now)
+
+	rows := append(c.highlighter.closedRows(), data.Connections...)
 
 	filterType := system.Instance.GetFilterType()
 	filterStatus := system.Instance.GetFilterStatus()
-	for _, conn := range c.data.Connections {
-		if filterType == "tcp" && conn.Protocol != "TCP" {
-			continue
-		}
-		if filterType == "udp" && conn.Protocol != "UDP" {
-			continue
-		}
-		if filterStatus == "LISTEN" && conn.State != "LISTEN" && (filterType == "tcp" || filterType == "all") {
-			continue
-		}
-		if filterStatus == "ESTABLISHED" && conn.State != "ESTABLISHED" && (filterType == "tcp" || filterType == "all") {
+	conns := system.FilterConnections(rows, filterType, filterStatus)
+	conns = system.FilterNamespace(conns, system.Instance.GetFilterNamespace())
+	conns = system.FilterQuery(conns, system.Instance.GetFilterQuery())
+
+	system.SortConnections(conns, c.orderColumn, c.orderAsc)
+
+	c.rows = c.buildRows(conns)
+	c.updateDetails()
+
+	columns := c.visibleColumns()
+	c.tableResults.SetRowCount(len(c.rows))
+	for i, row := range c.rows {
+		if row.header {
+			c.updateHeaderRow(i, row, len(columns))
 			continue
 		}
-		if filterStatus == "OTHER" && (conn.State == "LISTEN" || conn.State == "ESTABLISHED") && (filterType == "tcp" || filterType == "all") {
-			continue
+		rowColor := c.highlighter.rowColor(row.conn)
+		for col, column := range columns {
+			c.updateCell(i, col, column.key, row.conn, rowColor)
 		}
-		conns = append(conns, conn)
 	}
+}
 
-	sort.Slice(conns, func(i, j int) bool {
-		switch c.orderColumnIndex {
-		case 0:
-			if c.orderAsc {
-				return conns[i].Protocol < conns[j].Protocol
-			} else {
-				return conns[i].Protocol > conns[j].Protocol
-			}
-		case 1:
-			if c.orderAsc {
-				return conns[i].LocalPort < conns[j].LocalPort
-			} else {
-				return conns[i].LocalPort > conns[j].LocalPort
-			}
-		case 2:
-			if c.orderAsc {
-				return conns[i].LocalAddr < conns[j].LocalAddr
-			} else {
-				return conns[i].LocalAddr > conns[j].LocalAddr
-			}
-		case 3:
-			if c.orderAsc {
-				return conns[i].RemoteAddr < conns[j].RemoteAddr
-			} else {
-				return conns[i].RemoteAddr > conns[j].RemoteAddr
-			}
-		case 4:
-			if c.orderAsc {
-				return conns[i].RemotePort < conns[j].RemotePort
-			} else {
-				return conns[i].RemotePort > conns[j].RemotePort
-			}
-		case 5:
-			if c.orderAsc {
-				return conns[i].State < conns[j].State
-			} else {
-				return conns[i].State > conns[j].State
-			}
-		case 6:
-			if c.orderAsc {
-				return conns[i].PID < conns[j].PID
-			} else {
-				return conns[i].PID > conns[j].PID
-			}
-		case 7:
-			if c.orderAsc {
-				return conns[i].ProcessName < conns[j].ProcessName
-			} else {
-				return conns[i].ProcessName > conns[j].ProcessName
-			}
-		case 8:
-			serviceA := system.Instance.GetServiceByPort(conns[i].LocalPort)
-			if serviceA == "" {
-				serviceA = system.Instance.GetServiceByPort(conns[i].RemotePort)
-			}
-			serviceB := system.Instance.GetServiceByPort(conns[j].LocalPort)
-			if serviceB == "" {
-				serviceB = system.Instance.GetServiceByPort(conns[j].RemotePort)
-			}
-			if c.orderAsc {
-				return serviceA < serviceB
-			}
-			return serviceA > serviceB
-		case 9:
-			countryA, errA := system.GetCountryByIP(conns[i].RemoteAddr)
-			if errA != nil {
-				countryA = ""
-			}
-			countryB, errB := system.GetCountryByIP(conns[j].RemoteAddr)
-			if errB != nil {
-				countryB = ""
-			}
-			if c.orderAsc {
-				return countryA < countryB
-			} else {
-				return countryA > countryB
-			}
-		default:
-			return true
+func (c *CenterPanel) updateHeaderRow(row int, header tableRow, columnCount int) {
+	for col := 0; col < columnCount; col++ {
+		text := ""
+		if col == 0 {
+			text = header.headerText()
 		}
-	})
-
-	c.tableResults.SetRowCount(len(conns))
-	for i, conn := range conns {
-		// TYPE
-		c.tableResults.SetCellText2(i, 0, conn.Protocol)
-
-		// LOCAL PORT
-		c.tableResults.SetCellText2(i, 1, fmt.Sprintf("%d", conn.LocalPort))
-
-		// LOCAL ADDRESS
-		c.tableResults.SetCellText2(i, 2, conn.LocalAddr)
-		c.tableResults.SetCellColor(i, 2, color.RGBA{100, 100, 100, 255})
+		c.tableResults.SetCellText2(row, col, text)
+		c.tableResults.SetCellColor(row, col, groupHeaderColor)
+		c.tableResults.SetCellImage(row, col, nil, 0)
+	}
+}
 
-		// REMOTE ADDRESS
-		c.tableResults.SetCellText2(i, 3, conn.RemoteAddr)
-		c.tableResults.SetCellColor(i, 3, ui.ColorFromHex("#E57373"))
-		if conn.State == "LISTEN" {
-			c.tableResults.SetCellText2(i, 3, "")
+// updateCell renders one cell. rowColor marks new and closed rows, nil
+// keeps the default color of the column.
+func (c *CenterPanel) updateCell(row int, col int, key string, conn system.ConnectionInfo, rowColor color.Color) {
+	text := ""
+	var cellColor color.Color
+	var flagImage image.Image
+
+	switch key {
+	case system.ColumnType:
+		text = conn.Protocol
+		if conn.Protocol == "UNIX" {
+			text = "UNIX/" + conn.SocketType
+		}
+	case system.ColumnLocalPort:
+		if conn.Protocol != "UNIX" {
+			text = fmt.Sprintf("%d", conn.LocalPort)
 		}
-		if conn.RemoteAddr == "0.0.0.0" || conn.RemoteAddr == "::" || conn.RemoteAddr == "127.0.0.1" {
-			c.tableResults.SetCellColor(i, 3, color.RGBA{100, 100, 100, 255})
+	case system.ColumnLocalAddress:
+		// The path of a UNIX socket is shown as its address
+		text = system.FormatAddress(conn.LocalAddr)
+		cellColor = color.RGBA{100, 100, 100, 255}
+	case system.ColumnRemoteAddress:
+		if conn.State != "LISTEN" {
+			text = system.FormatAddress(conn.RemoteAddr)
+		}
+		cellColor = ui.ColorFromHex("#E57373")
+		if system.Instance.IsLoopbackOrUnspecified(conn.RemoteAddr) {
+			cellColor = color.RGBA{100, 100, 100, 255}
 		}
 		if system.Instance.IsLocalAreaNetwork(conn.RemoteAddr) {
-			c.tableResults.SetCellColor(i, 3, color.RGBA{100, 255, 100, 255})
+			cellColor = color.RGBA{100, 255, 100, 255}
 		}
-
-		// REMOTE PORT
+	case system.ColumnRemotePort:
 		if conn.RemotePort > 0 {
-			c.tableResults.SetCellText2(i, 4, fmt.Sprintf("%d", conn.RemotePort))
-		} else {
-			c.tableResults.SetCellText2(i, 4, "")
-		}
-
-		// STATUS
-		c.tableResults.SetCellText2(i, 5, conn.State)
-
-		// PID
-		c.tableResults.SetCellText2(i, 6, fmt.Sprintf("%d", conn.PID))
-		c.tableResults.SetCellColor(i, 6, color.RGBA{100, 100, 100, 255})
-
-		// PROGRAM
-		c.tableResults.SetCellText2(i, 7, conn.ProcessName)
-
-		// SERVICE
-		service := system.Instance.GetServiceByPort(conn.LocalPort)
-		if service == "" {
-			service = system.Instance.GetServiceByPort(conn.RemotePort)
+			text = fmt.Sprintf("%d", conn.RemotePort)
 		}
-		c.tableResults.SetCellText2(i, 8, service)
-
-		// COUNTRY
+	case system.ColumnStatus:
+		text = conn.State
+	case system.ColumnPID:
+		text = fmt.Sprintf("%d", conn.PID)
+		cellColor = color.RGBA{100, 100, 100, 255}
+	case system.ColumnProgram:
+		text = system.ProgramLabel(conn)
+	case system.ColumnContainer:
+		text = system.ContainerLabel(conn)
+	case system.ColumnNetNS:
+		text = system.NetNSLabel(conn)
+	case system.ColumnService:
+		text = system.Instance.GetServiceByConnection(conn)
+	case system.ColumnCountry:
 		country, err := system.GetCountryByIP(conn.RemoteAddr)
-		if err != nil {
-			country = ""
+		if err == nil {
+			text = country
 		}
-		c.tableResults.SetCellText2(i, 9, country)
-
 		countryISO, err := system.GetCountryISOCodeByIP(conn.RemoteAddr)
 		if err == nil && countryISO != "" {
-			im, _ := flags.GetFlagImage(countryISO)
-			c.tableResults.SetCellImage(i, 9, im, 24)
-		} else {
-			c.tableResults.SetCellImage(i, 9, nil, 0)
+			flagImage, _ = flags.GetFlagImage(countryISO)
 		}
+	default:
+		text = system.FormatStat(conn, key)
+	}
+
+	// NEW / CLOSED highlighting overrides the column color
+	if rowColor != nil {
+		cellColor = rowColor
+	}
+
+	c.tableResults.SetCellText2(row, col, text)
+	c.tableResults.SetCellColor(row, col, cellColor)
+	if flagImage != nil {
+		c.tableResults.SetCellImage(row, col, flagImage, 24)
+	} else {
+		c.tableResults.SetCellImage(row, col, nil, 0)
 	}
 }
@@ -0,0 +1,199 @@
+package centerpanel
+
+import (
+	"slices"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/settings"
+	"github.com/u00io/localports/system"
+	"github.com/u00io/nuiforms/ui"
+)
+
+// widthSaveDelay is how long a column must keep its width before it is
+// saved, so dragging it doesn't write the settings at every step
+const widthSaveDelay = 500 * time.Millisecond
+
+// tableColumn is one column of the connection table. Hidden columns are
+// not passed to the table at all, so table indexes only count visible ones.
+type tableColumn struct {
+	key    string // system.SortConnections key
+	name   string
+	width  int
+	hidden bool
+	stats  bool // Socket statistics, toggled together
+}
+
+func defaultColumns() []tableColumn {
+	return []tableColumn{
+		{key: system.ColumnType, name: "Type", width: 120},
+		{key: system.ColumnLocalPort, name: "Local Port", width: 160},
+		{key: system.ColumnLocalAddress, name: "Local Address", width: 220},
+		{key: system.ColumnRemoteAddress, name: "Remote Address", width: 220},
+		{key: system.ColumnRemotePort, name: "Remote Port", width: 160},
+		{key: system.ColumnStatus, name: "Status", width: 160},
+		{key: system.ColumnPID, name: "PID", width: 80},
+		{key: system.ColumnProgram, name: "Program", width: 220},
+		{key: system.ColumnService, name: "Service", width: 220},
+		{key: system.ColumnCountry, name: "Country", width: 180},
+		{key: system.ColumnContainer, name: "Container/Unit", width: 200},
+		{key: system.ColumnNetNS, name: "Net NS", width: 180, hidden: true},
+		{key: system.ColumnRTT, name: "RTT", width: 110, hidden: true, stats: true},
+		{key: system.ColumnRetransmits, name: "Retrans", width: 100, hidden: true, stats: true},
+		{key: system.ColumnSendQueue, name: "Send-Q", width: 110, hidden: true, stats: true},
+		{key: system.ColumnRecvQueue, name: "Recv-Q", width: 110, hidden: true, stats: true},
+		{key: system.ColumnBytesAcked, name: "Bytes Sent", width: 130, hidden: true, stats: true},
+		{key: system.ColumnBytesReceived, name: "Bytes Received", width: 130, hidden: true, stats: true},
+		{key: system.ColumnRateIn, name: "In/s", width: 120, hidden: true, stats: true},
+		{key: system.ColumnRateOut, name: "Out/s", width: 120, hidden: true, stats: true},
+	}
+}
+
+func (c *CenterPanel) visibleColumns() []tableColumn {
+	result := make([]tableColumn, 0, len(c.columns))
+	for _, column := range c.columns {
+		if !column.hidden {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// columnWidth returns the width set by the user, from the settings, or
+// the default one
+func (c *CenterPanel) columnWidth(column tableColumn) int {
+	if width, ok := c.resizedWidths[column.key]; ok {
+		return width
+	}
+	if width, ok := c.columnWidths[column.key]; ok && width > 0 {
+		return width
+	}
+	return column.width
+}
+
+// applySettings takes the column widths, the row highlighting and, when
+// that column is shown, the sort order from the settings
+func (c *CenterPanel) applySettings(s settings.Settings, withSort bool) {
+	c.columnWidths = s.ColumnWidths
+	c.highlighter.newDuration = s.HighlightDuration()
+	c.highlighter.closedLinger = s.ClosedLinger()
+	c.highlighter.newColor = ui.ColorFromHex(s.NewRowColor)
+	c.highlighter.closedColor = ui.ColorFromHex(s.ClosedRowColor)
+	if withSort {
+		for _, column := range c.visibleColumns() {
+			if column.key == s.SortColumn {
+				c.orderColumn = s.SortColumn
+				c.orderAsc = s.SortAsc
+			}
+		}
+	}
+	c.updateColumns()
+}
+
+// saveSort remembers the sort order for the next start
+func (c *CenterPanel) saveSort() {
+	orderColumn, orderAsc := c.orderColumn, c.orderAsc
+	err := settings.Update(func(s *settings.Settings) {
+		s.SortColumn = orderColumn
+		s.SortAsc = orderAsc
+	})
+	if err != nil {
+		logger.Println("can not save settings:", err)
+	}
+}
+
+// OnColumnResized keeps the width of a column dragged by the user until
+// SaveColumnWidths writes it
+func (c *CenterPanel) OnColumnResized(index int, width int) {
+	columns := c.visibleColumns()
+	if index < 0 || index >= len(columns) || width <= 0 {
+		return
+	}
+	if c.resizedWidths == nil {
+		c.resizedWidths = make(map[string]int)
+	}
+	c.resizedWidths[columns[index].key] = width
+	c.resizedAt = time.Now()
+}
+
+// SaveColumnWidths saves the widths dragged by the user. Without force
+// it waits until no column was resized for widthSaveDelay.
+func (c *CenterPanel) SaveColumnWidths(force bool) {
+	if len(c.resizedWidths) == 0 || (!force && time.Since(c.resizedAt) < widthSaveDelay) {
+		return
+	}
+	widths := c.resizedWidths
+	c.resizedWidths = nil
+	err := settings.Update(func(s *settings.Settings) {
+		for key, width := range widths {
+			s.ColumnWidths[key] = width
+		}
+	})
+	if err != nil {
+		logger.Println("can not save settings:", err)
+	}
+}
+
+// SetColumnVisible shows or hides a column by its sort key. Sorting falls
+// back to the local port when the sort column is hidden.
+func (c *CenterPanel) SetColumnVisible(key string, visible bool) {
+	c.setColumnVisible(key, visible)
+	c.updateColumns()
+	c.updateData()
+}
+
+// SetStatsVisible toggles all socket statistics columns
+func (c *CenterPanel) SetStatsVisible(visible bool) {
+	for _, column := range c.columns {
+		if column.stats {
+			c.setColumnVisible(column.key, visible)
+		}
+	}
+	c.updateColumns()
+	c.updateData()
+}
+
+func (c *CenterPanel) setColumnVisible(key string, visible bool) {
+	for i := range c.columns {
+		if c.columns[i].key == key {
+			c.columns[i].hidden = !visible
+		}
+	}
+	if !visible && c.orderColumn == key {
+		c.orderColumn = system.ColumnLocalPort
+		c.orderAsc = true
+	}
+}
+
+// FillPreset stores the sort order and the visible columns in the preset
+func (c *CenterPanel) FillPreset(preset *system.FilterPreset) {
+	preset.SortColumn = c.orderColumn
+	preset.SortAsc = c.orderAsc
+	preset.Columns = nil
+	for _, column := range c.visibleColumns() {
+		preset.Columns = append(preset.Columns, column.key)
+	}
+}
+
+// ApplyPreset restores the sort order and the visible columns. Columns
+// unknown to this version are ignored; without columns the defaults are
+// shown.
+func (c *CenterPanel) ApplyPreset(preset system.FilterPreset) {
+	c.columns = defaultColumns()
+	if len(preset.Columns) > 0 {
+		for i := range c.columns {
+			c.columns[i].hidden = !slices.Contains(preset.Columns, c.columns[i].key)
+		}
+	}
+
+	c.orderColumn = system.ColumnLocalPort
+	c.orderAsc = true
+	for _, column := range c.visibleColumns() {
+		if column.key == preset.SortColumn {
+			c.orderColumn = preset.SortColumn
+			c.orderAsc = preset.SortAsc
+		}
+	}
+	c.updateColumns()
+	c.updateData()
+}
@@ -0,0 +1,44 @@
+package centerpanel
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/u00io/localports/settings"
+	"github.com/u00io/localports/system"
+	"github.com/u00io/nuiforms/ui"
+)
+
+func TestSaveColumnWidths(t *testing.T) {
+	settings.Init(filepath.Join(t.TempDir(), "settings.json"))
+	c := &CenterPanel{columns: defaultColumns(), tableResults: ui.NewTable(), highlighter: newRowHighlighter()}
+	c.applySettings(settings.Get(), true)
+
+	// Dragging the local port column: only the last width is kept
+	for _, width := range []int{170, 190, 210} {
+		c.OnColumnResized(1, width)
+	}
+	c.OnColumnResized(99, 100)
+	c.SaveColumnWidths(false)
+	if len(settings.Get().ColumnWidths) != 0 {
+		t.Errorf("saved while dragging: %v", settings.Get().ColumnWidths)
+	}
+	if width := c.columnWidth(c.visibleColumns()[1]); width != 210 {
+		t.Errorf("shown width %d, want 210", width)
+	}
+
+	c.resizedAt = time.Now().Add(-widthSaveDelay)
+	c.SaveColumnWidths(false)
+	widths := settings.Get().ColumnWidths
+	if len(widths) != 1 || widths[system.ColumnLocalPort] != 210 {
+		t.Errorf("saved widths %v, want %s: 210", widths, system.ColumnLocalPort)
+	}
+
+	// Closing the window saves at once
+	c.OnColumnResized(0, 90)
+	c.SaveColumnWidths(true)
+	if width := settings.Get().ColumnWidths[system.ColumnType]; width != 90 {
+		t.Errorf("saved width of %s is %d, want 90", system.ColumnType, width)
+	}
+}
@@ -0,0 +1,74 @@
+package centerpanel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/u00io/localports/system"
+	"github.com/u00io/nuiforms/ui"
+)
+
+// OnSelectionChanged selects a connection. Selecting a group header
+// collapses or expands the group.
+func (c *CenterPanel) OnSelectionChanged(x int, y int) {
+	if y >= 0 && y < len(c.rows) && c.rows[y].header {
+		c.selectedKey = nil
+		c.ToggleGroup(c.rows[y].key)
+		return
+	}
+	if y < 0 || y >= len(c.rows) {
+		c.selectedKey = nil
+	} else {
+		key := system.KeyOf(c.rows[y].conn)
+		c.selectedKey = &key
+	}
+	c.updateDetails()
+}
+
+func (c *CenterPanel) selectedConnection() (system.ConnectionInfo, bool) {
+	if c.selectedKey == nil {
+		return system.ConnectionInfo{}, false
+	}
+	for _, row := range c.rows {
+		if !row.header && system.KeyOf(row.conn) == *c.selectedKey {
+			return row.conn, true
+		}
+	}
+	return system.ConnectionInfo{}, false
+}
+
+// updateDetails shows the owning process of the selected row
+func (c *CenterPanel) updateDetails() {
+	lblDetails, ok := c.FindWidgetByName("lblDetails").(*ui.Label)
+	if !ok {
+		return
+	}
+
+	conn, ok := c.selectedConnection()
+	c.updateKillButtons(conn, ok)
+	if !ok {
+		lblDetails.SetText("")
+		return
+	}
+	text := processDetails(conn.Process)
+	if activation, ok := system.SystemdSocketUnit(conn); ok {
+		text += fmt.Sprintf("   |   socket unit %s, starts %s", activation.Socket, activation.Service)
+	}
+	lblDetails.SetText(text)
+}
+
+func processDetails(p system.ProcessInfo) string {
+	parts := []string{fmt.Sprintf("%s (PID %d, parent %d)", p.Name, p.PID, p.ParentPID)}
+	if p.User != "" {
+		parts = append(parts, "user "+p.User)
+	}
+	if !p.StartTime.IsZero() {
+		parts = append(parts, "started "+p.StartTime.Format("2006-01-02 15:04:05"))
+	}
+	if p.CommandLine != "" {
+		parts = append(parts, p.CommandLine)
+	} else if p.ExePath != "" {
+		parts = append(parts, p.ExePath)
+	}
+	return strings.Join(parts, "   |   ")
+}
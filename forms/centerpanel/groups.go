@@ -0,0 +1,155 @@
+package centerpanel
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/u00io/localports/system"
+)
+
+// Values of groupBy
+const (
+	groupNone      = ""
+	groupContainer = "container"
+	groupProcess   = "process"
+)
+
+// hostGroup collects the rows without container or unit
+const hostGroup = "(host)"
+
+var groupHeaderColor = color.RGBA{144, 202, 249, 255}
+
+// tableRow is a connection or, when grouping, the header of a group.
+// Headers nest by depth; collapsing a header hides the rows below it up
+// to the next header of the same or a lower depth.
+type tableRow struct {
+	header bool
+	group  string
+	key    string // Identifies the group for collapsing
+	depth  int
+	conn   system.ConnectionInfo
+
+	count       int
+	listen      int
+	established int
+	collapsed   bool
+}
+
+func (r tableRow) headerText() string {
+	marker := "▾"
+	if r.collapsed {
+		marker = "▸"
+	}
+	text := fmt.Sprintf("%s%s %s (%d", strings.Repeat("    ", r.depth), marker, r.group, r.count)
+	if r.listen > 0 {
+		text += fmt.Sprintf(", %d listening", r.listen)
+	}
+	if r.established > 0 {
+		text += fmt.Sprintf(", %d established", r.established)
+	}
+	return text + ")"
+}
+
+// newGroupHeader counts the connections of a group
+func newGroupHeader(group string, key string, depth int, conns []system.ConnectionInfo) tableRow {
+	row := tableRow{header: true, group: group, key: key, depth: depth, count: len(conns)}
+	for _, conn := range conns {
+		switch conn.State {
+		case "LISTEN":
+			row.listen++
+		case "ESTABLISHED":
+			row.established++
+		}
+	}
+	return row
+}
+
+// SetGroupBy groups the rows by container/unit ("container"), by process
+// tree ("process") or shows a flat list ("")
+func (c *CenterPanel) SetGroupBy(groupBy string) {
+	c.groupBy = groupBy
+	c.updateData()
+}
+
+// ToggleGroup collapses or expands the group of a header row
+func (c *CenterPanel) ToggleGroup(key string) {
+	c.collapsed[key] = !c.collapsed[key]
+	c.updateData()
+}
+
+// buildRows turns the sorted connections into table rows. Rows keep their
+// order within a group, so sorting applies within groups.
+func (c *CenterPanel) buildRows(conns []system.ConnectionInfo) []tableRow {
+	var rows []tableRow
+	switch c.groupBy {
+	case groupContainer:
+		rows = buildContainerRows(conns)
+	case groupProcess:
+		rows = buildProcessRows(conns, system.Instance.GetProcesses())
+	default:
+		rows = make([]tableRow, 0, len(conns))
+		for _, conn := range conns {
+			rows = append(rows, tableRow{conn: conn})
+		}
+		return rows
+	}
+	return c.collapseRows(rows)
+}
+
+// collapseRows marks the collapsed headers and drops the rows they hide
+func (c *CenterPanel) collapseRows(rows []tableRow) []tableRow {
+	result := make([]tableRow, 0, len(rows))
+	hiddenBelow := -1
+	for _, row := range rows {
+		if hiddenBelow >= 0 {
+			if !row.header || row.depth > hiddenBelow {
+				continue
+			}
+			hiddenBelow = -1
+		}
+		if row.header && c.collapsed[row.key] {
+			row.collapsed = true
+			hiddenBelow = row.depth
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+// buildContainerRows orders the groups by name with the host first
+func buildContainerRows(conns []system.ConnectionInfo) []tableRow {
+	groups := make(map[string][]system.ConnectionInfo)
+	for _, conn := range conns {
+		group := containerGroupName(conn)
+		groups[group] = append(groups[group], conn)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == hostGroup) != (names[j] == hostGroup) {
+			return names[i] == hostGroup
+		}
+		return names[i] < names[j]
+	})
+
+	rows := make([]tableRow, 0, len(conns)+len(names))
+	for _, name := range names {
+		rows = append(rows, newGroupHeader(name, name, 0, groups[name]))
+		for _, conn := range groups[name] {
+			rows = append(rows, tableRow{group: name, depth: 1, conn: conn})
+		}
+	}
+	return rows
+}
+
+func containerGroupName(conn system.ConnectionInfo) string {
+	if label := system.ContainerLabel(conn); label != "" {
+		return label
+	}
+	return hostGroup
+}
@@ -0,0 +1,89 @@
+package centerpanel
+
+import (
+	"image/color"
+	"time"
+
+	"github.com/u00io/localports/system"
+	"github.com/u00io/nuiforms/ui"
+)
+
+// rowMark highlights a row that appeared or disappeared recently
+type rowMark struct {
+	since  time.Time
+	closed bool
+	conn   system.ConnectionInfo
+}
+
+type rowHighlighter struct {
+	newDuration  time.Duration
+	closedLinger time.Duration
+	newColor     color.Color
+	closedColor  color.Color
+
+	initialized bool
+	prev        []system.ConnectionInfo
+	marks       map[system.ConnectionKey]*rowMark
+}
+
+func newRowHighlighter() *rowHighlighter {
+	var c rowHighlighter
+	c.newDuration = 3 * time.Second
+	c.closedLinger = 5 * time.Second
+	c.newColor = ui.ColorFromHex("#81C784")
+	c.closedColor = color.RGBA{70, 70, 70, 255}
+	c.marks = make(map[system.ConnectionKey]*rowMark)
+	return &c
+}
+
+// update compares a new snapshot with the previous one. The first
+// snapshot is not highlighted.
+func (c *rowHighlighter) update(conns []system.ConnectionInfo, now time.Time) {
+	if c.initialized {
+		for _, change := range system.DiffSnapshots(c.prev, conns) {
+			switch change.Type {
+			case system.ConnectionOpened:
+				c.marks[change.Key] = &rowMark{since: now}
+			case system.ConnectionClosed:
+				c.marks[change.Key] = &rowMark{since: now, closed: true, conn: change.Old}
+			}
+		}
+	}
+	c.initialized = true
+	c.prev = conns
+}
+
+func (c *rowHighlighter) expire(now time.Time) {
+	for key, mark := range c.marks {
+		limit := c.newDuration
+		if mark.closed {
+			limit = c.closedLinger
+		}
+		if now.Sub(mark.since) >= limit {
+			delete(c.marks, key)
+		}
+	}
+}
+
+// closedRows returns the closed connections that are still lingering
+func (c *rowHighlighter) closedRows() []system.ConnectionInfo {
+	result := make([]system.ConnectionInfo, 0)
+	for _, mark := range c.marks {
+		if mark.closed {
+			result = append(result, mark.conn)
+		}
+	}
+	return result
+}
+
+// rowColor returns the highlight color of the row or nil
+func (c *rowHighlighter) rowColor(conn system.ConnectionInfo) color.Color {
+	mark, ok := c.marks[system.KeyOf(conn)]
+	if !ok {
+		return nil
+	}
+	if mark.closed {
+		return c.closedColor
+	}
+	return c.newColor
+}
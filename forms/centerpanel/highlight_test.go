@@ -0,0 +1,78 @@
+package centerpanel
+
+import (
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/u00io/localports/system"
+)
+
+func TestRowHighlighter(t *testing.T) {
+	c := newRowHighlighter()
+	c.newDuration = 3 * time.Second
+	c.closedLinger = 5 * time.Second
+	c.newColor = color.RGBA{0, 255, 0, 255}
+	c.closedColor = color.RGBA{70, 70, 70, 255}
+
+	web := system.ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 80, State: "LISTEN", PID: 10, ProcessName: "nginx"}
+	db := system.ConnectionInfo{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 5432, State: "LISTEN", PID: 20, ProcessName: "postgres"}
+	ssh := system.ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 22, State: "LISTEN", PID: 30, ProcessName: "sshd"}
+
+	start := time.Unix(1700000000, 0)
+	step := func(d time.Duration, conns ...system.ConnectionInfo) {
+		now := start.Add(d)
+		c.update(conns, now)
+		c.expire(now)
+	}
+
+	// The first snapshot is what was there before, nothing is marked
+	step(0, web, db)
+	if c.rowColor(web) != nil || c.rowColor(db) != nil || len(c.closedRows()) != 0 {
+		t.Fatal("rows of the first snapshot are highlighted")
+	}
+
+	// ssh opens, db closes
+	step(time.Second, web, ssh)
+	if c.rowColor(ssh) != c.newColor {
+		t.Errorf("new row color = %v, want %v", c.rowColor(ssh), c.newColor)
+	}
+	if c.rowColor(web) != nil {
+		t.Error("unchanged row is highlighted")
+	}
+	closed := c.closedRows()
+	if len(closed) != 1 || closed[0].LocalPort != 5432 || c.rowColor(db) != c.closedColor {
+		t.Errorf("closed rows = %+v, color %v", closed, c.rowColor(db))
+	}
+
+	// After 3s the new row is plain, the closed one still lingers
+	step(4*time.Second, web, ssh)
+	if c.rowColor(ssh) != nil {
+		t.Error("new row is still highlighted after the highlight time")
+	}
+	if len(c.closedRows()) != 1 {
+		t.Error("closed row is gone before its linger time")
+	}
+
+	// After 5s the closed row is gone as well
+	step(6*time.Second, web, ssh)
+	if len(c.closedRows()) != 0 || c.rowColor(db) != nil {
+		t.Error("closed row is still shown after its linger time")
+	}
+}
+
+func TestRowHighlighterOff(t *testing.T) {
+	c := newRowHighlighter()
+	c.newDuration = 0
+	c.closedLinger = 0
+
+	conn := system.ConnectionInfo{Protocol: "TCP", LocalPort: 80, State: "LISTEN", PID: 10}
+	now := time.Unix(1700000000, 0)
+	c.update(nil, now)
+	c.update([]system.ConnectionInfo{conn}, now)
+	c.update(nil, now)
+	c.expire(now)
+	if c.rowColor(conn) != nil || len(c.closedRows()) != 0 {
+		t.Error("rows are marked with highlighting turned off")
+	}
+}
@@ -0,0 +1,119 @@
+package centerpanel
+
+import (
+	"fmt"
+
+	"github.com/u00io/localports/system"
+	"github.com/u00io/nuiforms/ui"
+)
+
+// pendingKill waits for the second click that confirms it
+type pendingKill struct {
+	process system.ProcessInfo
+	signal  string
+}
+
+// OnTerminateClick sends TERM to the owner of the selected row, followed
+// by KILL when it doesn't exit
+func (c *CenterPanel) OnTerminateClick() {
+	c.requestKill("TERM")
+}
+
+// OnKillClick sends KILL to the owner of the selected row
+func (c *CenterPanel) OnKillClick() {
+	c.requestKill("KILL")
+}
+
+func (c *CenterPanel) OnKillCancelClick() {
+	c.pendingKill = nil
+	c.setKillText("")
+	c.updateDetails()
+}
+
+// requestKill asks for confirmation on the first click and signals the
+// process on the second click of the same button
+func (c *CenterPanel) requestKill(signal string) {
+	conn, ok := c.selectedConnection()
+	if !ok || conn.PID == 0 {
+		c.setKillText("Select a connection with a known process")
+		return
+	}
+	process := conn.Process
+
+	if p := c.pendingKill; p != nil && p.signal == signal && p.process.SameProcess(process) {
+		c.pendingKill = nil
+		c.setKillText(fmt.Sprintf("Sending %s to %s (PID %d)...", signal, process.Name, process.PID))
+		c.updateDetails()
+		go func() {
+			result, err := system.KillProcess(process, signal, system.DefaultKillTimeout)
+			system.Instance.EmitEvent("kill_result", killResultText(process, result, err))
+			system.Instance.EmitEvent("update", "")
+		}()
+		return
+	}
+
+	if err := system.CheckKillable(process); err != nil {
+		c.pendingKill = nil
+		c.setKillText(err.Error())
+		c.updateDetails()
+		return
+	}
+	c.pendingKill = &pendingKill{process: process, signal: signal}
+	button := "Kill"
+	if signal == "TERM" {
+		button = "Terminate"
+	}
+	c.setKillText(fmt.Sprintf("Send %s to %s (PID %d)? Click %s again to confirm", signal, process.Name, process.PID, button))
+	c.updateDetails()
+}
+
+func killResultText(process system.ProcessInfo, result system.KillResult, err error) string {
+	switch {
+	case err != nil:
+		return err.Error()
+	case result.Escalated && result.Exited:
+		return fmt.Sprintf("%s (PID %d) ignored TERM and was killed", process.Name, process.PID)
+	case result.Exited:
+		return fmt.Sprintf("%s (PID %d) exited after %s", process.Name, process.PID, result.Signal)
+	default:
+		return fmt.Sprintf("Sent %s to %s (PID %d), it is still running", result.Signal, process.Name, process.PID)
+	}
+}
+
+func (c *CenterPanel) setKillText(text string) {
+	lblKill, ok := c.FindWidgetByName("lblKill").(*ui.Label)
+	if ok {
+		lblKill.SetText(text)
+	}
+}
+
+// updateKillButtons enables the actions for a selected connection with a
+// known owner. A pending confirmation is dropped when the selection moves
+// to another process.
+func (c *CenterPanel) updateKillButtons(conn system.ConnectionInfo, selected bool) {
+	selected = selected && conn.PID != 0
+	if c.pendingKill != nil && (!selected || !c.pendingKill.process.SameProcess(conn.Process)) {
+		c.pendingKill = nil
+		c.setKillText("")
+	}
+
+	for _, name := range []string{"btnTerminate", "btnKill"} {
+		if btn, ok := c.FindWidgetByName(name).(*ui.Button); ok {
+			btn.SetEnabled(selected)
+			btn.SetRole("")
+		}
+	}
+	if btnCancel, ok := c.FindWidgetByName("btnKillCancel").(*ui.Button); ok {
+		btnCancel.SetEnabled(c.pendingKill != nil)
+	}
+	if c.pendingKill == nil {
+		return
+	}
+	name := "btnKill"
+	if c.pendingKill.signal == "TERM" {
+		name = "btnTerminate"
+	}
+	if btn, ok := c.FindWidgetByName(name).(*ui.Button); ok {
+		btn.SetRole("primary")
+	}
+}
@@ -0,0 +1,136 @@
+package centerpanel
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/u00io/localports/system"
+)
+
+// maxTreeDepth limits the nesting of a process list that changed while
+// it was read
+const maxTreeDepth = 64
+
+// buildProcessRows nests the connections by process tree. A process
+// joins the tree of its parent when the parent owns connections too or
+// runs the same program, like the workers of an nginx master. Each tree
+// gets a header with the totals, each process of a larger tree its own.
+func buildProcessRows(conns []system.ConnectionInfo, processes map[uint32]system.ProcessInfo) []tableRow {
+	byPID := make(map[uint32][]system.ConnectionInfo)
+	pids := make([]uint32, 0)
+	for _, conn := range conns {
+		if _, exists := byPID[conn.PID]; !exists {
+			pids = append(pids, conn.PID)
+		}
+		byPID[conn.PID] = append(byPID[conn.PID], conn)
+	}
+
+	parentOf := func(pid uint32) (uint32, bool) {
+		process, ok := processes[pid]
+		if !ok || process.ParentPID <= 1 || process.ParentPID == pid {
+			return 0, false
+		}
+		parent, ok := processes[process.ParentPID]
+		if !ok {
+			return 0, false
+		}
+		if _, owns := byPID[parent.PID]; owns || parent.Name == process.Name {
+			return parent.PID, true
+		}
+		return 0, false
+	}
+
+	// Each walk goes up until it reaches a process that is already in a
+	// tree. A walk that finds no root, because of a PID loop or at the
+	// depth limit, makes its last process the root, so no socket is lost.
+	children := make(map[uint32][]uint32)
+	linked := make(map[uint32]bool)
+	var roots []uint32
+	for _, pid := range pids {
+		if linked[pid] {
+			continue
+		}
+		walk := make(map[uint32]bool)
+		current := pid
+		for depth := 0; ; depth++ {
+			linked[current] = true
+			walk[current] = true
+			parent, ok := parentOf(current)
+			if !ok || walk[parent] || depth+1 >= maxTreeDepth {
+				roots = append(roots, current)
+				break
+			}
+			children[parent] = append(children[parent], current)
+			if linked[parent] {
+				break
+			}
+			current = parent
+		}
+	}
+
+	processLabel := func(pid uint32) string {
+		if pid == 0 {
+			return "(no process)"
+		}
+		name := "?"
+		if process, ok := processes[pid]; ok {
+			name = process.Name
+		}
+		return fmt.Sprintf("%s (PID %d)", name, pid)
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		a, b := processes[roots[i]].Name, processes[roots[j]].Name
+		if a != b {
+			return a < b
+		}
+		return roots[i] < roots[j]
+	})
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	}
+
+	// subtree lists the processes of a tree, parents before children
+	var subtree func(pid uint32) []uint32
+	subtree = func(pid uint32) []uint32 {
+		result := []uint32{pid}
+		for _, child := range children[pid] {
+			result = append(result, subtree(child)...)
+		}
+		return result
+	}
+
+	rows := make([]tableRow, 0, len(conns))
+	for _, root := range roots {
+		members := subtree(root)
+		var treeConns []system.ConnectionInfo
+		for _, pid := range members {
+			treeConns = append(treeConns, byPID[pid]...)
+		}
+		rows = append(rows, newGroupHeader(processLabel(root), fmt.Sprintf("tree/%d", root), 0, treeConns))
+
+		if len(members) == 1 {
+			for _, conn := range byPID[root] {
+				rows = append(rows, tableRow{group: processLabel(root), depth: 1, conn: conn})
+			}
+			continue
+		}
+
+		var addProcess func(pid uint32, depth int)
+		addProcess = func(pid uint32, depth int) {
+			if own := byPID[pid]; len(own) > 0 {
+				label := processLabel(pid)
+				rows = append(rows, newGroupHeader(label, fmt.Sprintf("process/%d", pid), depth, own))
+				for _, conn := range own {
+					rows = append(rows, tableRow{group: label, depth: depth + 1, conn: conn})
+				}
+				depth++
+			}
+			for _, child := range children[pid] {
+				addProcess(child, depth)
+			}
+		}
+		addProcess(root, 1)
+	}
+	return rows
+}
@@ -0,0 +1,79 @@
+package centerpanel
+
+import (
+	"testing"
+
+	"github.com/u00io/localports/system"
+)
+
+// treeConnections counts the connection rows of every tree by its root
+func treeConnections(rows []tableRow) (map[string]int, int) {
+	trees := make(map[string]int)
+	total := 0
+	var root string
+	for _, row := range rows {
+		if row.header && row.depth == 0 {
+			root = row.group
+			continue
+		}
+		if !row.header {
+			trees[root]++
+			total++
+		}
+	}
+	return trees, total
+}
+
+func TestBuildProcessRows(t *testing.T) {
+	processes := map[uint32]system.ProcessInfo{
+		10: {PID: 10, ParentPID: 1, Name: "nginx"},
+		11: {PID: 11, ParentPID: 10, Name: "nginx"},
+		12: {PID: 12, ParentPID: 10, Name: "nginx"},
+		20: {PID: 20, ParentPID: 1, Name: "sshd"},
+	}
+	conns := []system.ConnectionInfo{
+		{PID: 11, LocalPort: 80},
+		{PID: 12, LocalPort: 443},
+		{PID: 20, LocalPort: 22},
+		{PID: 0, LocalPort: 50000},
+	}
+	trees, total := treeConnections(buildProcessRows(conns, processes))
+	if total != len(conns) {
+		t.Errorf("%d of %d connections shown", total, len(conns))
+	}
+	want := map[string]int{"nginx (PID 10)": 2, "sshd (PID 20)": 1, "(no process)": 1}
+	for root, count := range want {
+		if trees[root] != count {
+			t.Errorf("tree %s has %d connections, want %d (trees %v)", root, trees[root], count, trees)
+		}
+	}
+}
+
+func TestBuildProcessRowsLoops(t *testing.T) {
+	// A and B are each other's parent after PID reuse during the scan
+	processes := map[uint32]system.ProcessInfo{
+		100: {PID: 100, ParentPID: 200, Name: "app"},
+		200: {PID: 200, ParentPID: 100, Name: "app"},
+		300: {PID: 300, ParentPID: 400, Name: "worker"},
+		400: {PID: 400, ParentPID: 500, Name: "worker"},
+		500: {PID: 500, ParentPID: 400, Name: "worker"},
+	}
+	conns := []system.ConnectionInfo{
+		{PID: 100, LocalPort: 1},
+		{PID: 200, LocalPort: 2},
+		{PID: 300, LocalPort: 3},
+	}
+	// A chain deeper than maxTreeDepth
+	for pid := uint32(1000); pid < 1000+2*maxTreeDepth; pid++ {
+		processes[pid] = system.ProcessInfo{PID: pid, ParentPID: pid + 1, Name: "deep"}
+	}
+	conns = append(conns, system.ConnectionInfo{PID: 1000, LocalPort: 4})
+
+	trees, total := treeConnections(buildProcessRows(conns, processes))
+	if total != len(conns) {
+		t.Errorf("%d of %d connections shown (trees %v)", total, len(conns), trees)
+	}
+	if len(trees) != 3 {
+		t.Errorf("got trees %v, want one per loop and the chain", trees)
+	}
+}
@@ -0,0 +1,48 @@
+package mainform
+
+import "github.com/u00io/localports/system"
+
+// launchFilters are waiting to be applied by the timer of the window
+var launchFilters = make(chan system.FilterPreset, 16)
+
+// ShowFilter brings the window to the front and applies the filter of a
+// command line. It may be called from any goroutine, also before Run.
+func ShowFilter(filter system.FilterPreset) {
+	select {
+	case launchFilters <- filter:
+	default:
+	}
+}
+
+func (c *MainForm) applyLaunchFilters() {
+	for {
+		select {
+		case filter := <-launchFilters:
+			c.applyLaunchFilter(filter)
+		default:
+			return
+		}
+	}
+}
+
+// applyLaunchFilter keeps the current filters that the command line did
+// not give. A launch without a filter only raises the window.
+func (c *MainForm) applyLaunchFilter(filter system.FilterPreset) {
+	if filter.Type != "" || filter.Status != "" || filter.Query != "" {
+		var preset system.FilterPreset
+		c.topPanel.FillPreset(&preset)
+		if filter.Type != "" {
+			preset.Type = filter.Type
+		}
+		if filter.Status != "" {
+			preset.Status = filter.Status
+		}
+		if filter.Query != "" {
+			preset.Query = filter.Query
+		}
+		c.topPanel.ApplyPreset(preset)
+	}
+	if c.form != nil {
+		c.form.Activate()
+	}
+}
@@ -1,11 +1,14 @@
 package mainform
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
+	"github.com/u00io/gomisc/logger"
 	"github.com/u00io/localports/forms/bottompanel"
 	"github.com/u00io/localports/forms/centerpanel"
 	"github.com/u00io/localports/forms/toppanel"
+	"github.com/u00io/localports/settings"
 	"github.com/u00io/localports/system"
 	"github.com/u00io/nuiforms/ui"
 )
@@ -16,17 +19,38 @@ type MainForm struct {
 	topPanel    *toppanel.TopPanel
 	centerPanel *centerpanel.CenterPanel
 	bottomPanel *bottompanel.BottomPanel
+
+	presets *system.Presets
+	form    *ui.Form
+
+	// Size after the last resize, saved once the user stopped resizing
+	width     int
+	height    int
+	resizedAt time.Time
 }
 
-func NewMainForm() *MainForm {
-	system.Instance = system.NewSystem()
-	system.Instance.Start()
+// sizeSaveDelay is how long the window must keep its size before it is
+// saved, so dragging the border doesn't write the settings at every step
+const sizeSaveDelay = 500 * time.Millisecond
+
+func NewMainForm(collector system.Collector) *MainForm {
+	if system.Instance == nil {
+		system.Instance = system.NewSystem()
+		system.Instance.Start()
+	}
+
+	history, err := system.OpenHistory(system.HistoryDir(), system.DefaultHistoryRetention)
+	if err == nil {
+		system.Instance.SetHistory(history)
+	} else {
+		logger.Println("can not open history:", err)
+	}
 
 	var c MainForm
 	c.InitWidget()
 
 	c.topPanel = toppanel.NewTopPanel()
-	c.centerPanel = centerpanel.NewCenterPanel()
+	c.centerPanel = centerpanel.NewCenterPanel(collector)
 	c.bottomPanel = bottompanel.NewBottomPanel()
 
 	curstomWidgets := map[string]ui.Widgeter{
@@ -42,19 +66,30 @@ func NewMainForm() *MainForm {
 </column>
 	`, &c, curstomWidgets)
 
+	c.loadPresets()
+
+	// Subscribers may run on any goroutine, the panels get an event
+	settings.Subscribe(func(s settings.Settings) {
+		system.Instance.EmitEvent("settings", "")
+	})
+
 	c.AddTimer(50, c.timerUpdate)
 
 	return &c
 }
 
 func (c *MainForm) HandleSystemEvent(event system.Event) {
-	fmt.Println("Event:", event)
+	if strings.HasPrefix(event.Name, "preset_") {
+		c.handlePresetEvent(event)
+	}
 	c.topPanel.HandleSystemEvent(event)
 	c.centerPanel.HandleSystemEvent(event)
 	c.bottomPanel.HandleSystemEvent(event)
 }
 
 func (c *MainForm) timerUpdate() {
+	c.applyLaunchFilters()
+	c.saveWindowSize(false)
 	systemEvents := system.Instance.GetAndClearEvents()
 	if len(systemEvents) > 0 {
 		for _, ev := range systemEvents {
@@ -63,10 +98,47 @@ func (c *MainForm) timerUpdate() {
 	}
 }
 
-func Run() {
+// onResize keeps the new size of the window until saveWindowSize
+// writes it
+func (c *MainForm) onResize(width int, height int) {
+	c.width = width
+	c.height = height
+	c.resizedAt = time.Now()
+}
+
+// saveWindowSize saves the size the user gave the window. Without force
+// it waits until the window was not resized for sizeSaveDelay.
+func (c *MainForm) saveWindowSize(force bool) {
+	if c.resizedAt.IsZero() || (!force && time.Since(c.resizedAt) < sizeSaveDelay) {
+		return
+	}
+	c.resizedAt = time.Time{}
+	s := settings.Get()
+	if c.width <= 0 || c.height <= 0 || (c.width == s.WindowWidth && c.height == s.WindowHeight) {
+		return
+	}
+	width, height := c.width, c.height
+	err := settings.Update(func(s *settings.Settings) {
+		s.WindowWidth = width
+		s.WindowHeight = height
+	})
+	if err != nil {
+		logger.Println("can not save settings:", err)
+	}
+}
+
+func Run(collector system.Collector) {
+	s := settings.Get()
 	form := ui.NewForm()
 	form.SetTitle("Local Ports")
-	form.SetSize(1300, 800)
-	form.Panel().AddWidgetOnGrid(NewMainForm(), 0, 0)
+	form.SetSize(s.WindowWidth, s.WindowHeight)
+	mainForm := NewMainForm(collector)
+	mainForm.form = form
+	form.SetOnResize(mainForm.onResize)
+	form.Panel().AddWidgetOnGrid(mainForm, 0, 0)
 	form.Exec()
+
+	// Changes made just before closing didn't wait out their delay
+	mainForm.saveWindowSize(true)
+	mainForm.centerPanel.SaveColumnWidths(true)
 }
@@ -0,0 +1,88 @@
+package mainform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/system"
+)
+
+// loadPresets reads the saved presets and applies the startup default.
+// Without a default the window keeps the sort order from the settings.
+func (c *MainForm) loadPresets() {
+	presets, err := system.LoadPresets()
+	if err != nil {
+		logger.Println("can not load presets:", err)
+		presets = &system.Presets{Version: system.PresetsVersion}
+	}
+	c.presets = presets
+	if presets.Default != "" {
+		c.applyPreset(presets.StartupPreset())
+	}
+	c.showPresets()
+}
+
+func (c *MainForm) applyPreset(preset system.FilterPreset) {
+	c.topPanel.ApplyPreset(preset)
+	c.centerPanel.ApplyPreset(preset)
+}
+
+// handlePresetEvent runs the preset buttons of the top panel
+func (c *MainForm) handlePresetEvent(event system.Event) {
+	name := strings.TrimSpace(event.Parameter)
+	if name == "" {
+		c.topPanel.SetPresetsText("Enter a preset name")
+		return
+	}
+
+	switch event.Name {
+	case "preset_load":
+		preset, ok := c.presets.Get(name)
+		if !ok {
+			c.topPanel.SetPresetsText(fmt.Sprintf("No preset %q", name))
+			return
+		}
+		c.applyPreset(preset)
+		c.showPresets()
+		return
+	case "preset_save":
+		preset := system.FilterPreset{Name: name}
+		c.topPanel.FillPreset(&preset)
+		c.centerPanel.FillPreset(&preset)
+		c.presets.Set(preset)
+	case "preset_default":
+		if _, ok := c.presets.Get(name); !ok {
+			c.topPanel.SetPresetsText(fmt.Sprintf("No preset %q", name))
+			return
+		}
+		c.presets.Default = name
+	case "preset_delete":
+		if !c.presets.Delete(name) {
+			c.topPanel.SetPresetsText(fmt.Sprintf("No preset %q", name))
+			return
+		}
+	}
+
+	if err := c.presets.Save(); err != nil {
+		logger.Println("can not save presets:", err)
+		c.topPanel.SetPresetsText("Can not save: " + err.Error())
+		return
+	}
+	c.showPresets()
+}
+
+// showPresets lists the saved presets, the default one marked with "*"
+func (c *MainForm) showPresets() {
+	names := c.presets.Names()
+	if len(names) == 0 {
+		c.topPanel.SetPresetsText("Presets")
+		return
+	}
+	for i, name := range names {
+		if name == c.presets.Default {
+			names[i] = name + "*"
+		}
+	}
+	c.topPanel.SetPresetsText("Presets: " + strings.Join(names, ", "))
+}
@@ -1,6 +1,8 @@
 package toppanel
 
 import (
+	"slices"
+
 	"github.com/u00io/localports/system"
 	"github.com/u00io/nuiforms/ui"
 )
@@ -9,17 +11,29 @@ type TopPanel struct {
 	ui.Widget
 
 	autoupdateOn bool
+	statsOn      bool
+	groupBy      string
 
-	filterType   string
-	filterStatus string
+	filterType      string
+	filterStatus    string
+	filterNamespace string
 
 	firstUpdateDone bool
+
+	txtSearch *ui.TextBox
+	txtPreset *ui.TextBox
 }
 
 func NewTopPanel() *TopPanel {
 	var c TopPanel
 	c.InitWidget()
 	c.SetElevation(5)
+	c.txtSearch = ui.NewTextBox()
+	c.txtPreset = ui.NewTextBox()
+	customWidgets := map[string]ui.Widgeter{
+		"txtsearch": c.txtSearch,
+		"txtpreset": c.txtPreset,
+	}
 	c.SetLayout(`
 		<row>
 			<column pagging="0" spacing="0">
@@ -46,6 +60,8 @@ func NewTopPanel() *TopPanel {
 					<panel />
 					<button id="btnUdp" text="UDP" onclick="OnUdpClick" />
 					<panel />
+					<button id="btnUnix" text="UNIX" onclick="OnUnixClick" />
+					<panel />
 					<button id="btnAll" text="ALL" onclick="OnAllClick" />
 				</row>
 			</column>
@@ -68,22 +84,92 @@ func NewTopPanel() *TopPanel {
 				</row>
 			</column>
 
+			<panel padding="2" autofillbackground="true"/>
+
+			<column pagging="0" spacing="0">
+				<label text="Namespace" textAlign="center"/>
+				<panel />
+				<frame autofillbackground="true" padding="2" />
+				<panel />
+				<row padding="0" spacing="0">
+					<button id="btnNamespaceHost" text="Host" onclick="OnNamespaceHostClick" />
+					<panel />
+					<button id="btnNamespaceOther" text="Other" onclick="OnNamespaceOtherClick" />
+					<panel />
+					<button id="btnNamespaceAll" text="ALL" onclick="OnNamespaceAllClick" />
+				</row>
+			</column>
+
+			<panel padding="2" autofillbackground="true"/>
+
+			<column pagging="0" spacing="0">
+				<label text="View" textAlign="center"/>
+				<panel />
+				<frame autofillbackground="true" padding="2" />
+				<panel />
+				<row padding="0" spacing="0">
+					<button id="btnStats" text="Stats" onclick="OnStatsClick" />
+					<panel />
+					<button id="btnGroupContainer" text="By Container" onclick="OnGroupContainerClick" />
+					<panel />
+					<button id="btnGroupProcess" text="By Process" onclick="OnGroupProcessClick" />
+				</row>
+			</column>
+
+			<panel padding="2" autofillbackground="true"/>
+
+			<column pagging="0" spacing="0">
+				<label id="lblSearch" text="Search" textAlign="center"/>
+				<panel />
+				<frame autofillbackground="true" padding="2" />
+				<panel />
+				<widget id="txtsearch" />
+			</column>
+
+			<panel padding="2" autofillbackground="true"/>
+
+			<column pagging="0" spacing="0">
+				<label id="lblPresets" text="Presets" textAlign="center"/>
+				<panel />
+				<frame autofillbackground="true" padding="2" />
+				<panel />
+				<row padding="0" spacing="0">
+					<widget id="txtpreset" />
+					<panel />
+					<button text="Load" onclick="OnPresetLoadClick" />
+					<panel />
+					<button text="Save" onclick="OnPresetSaveClick" />
+					<panel />
+					<button text="Default" onclick="OnPresetDefaultClick" />
+					<panel />
+					<button text="Delete" onclick="OnPresetDeleteClick" />
+				</row>
+			</column>
+
 			<hspacer />
 		</row>
-	`, &c, nil)
+	`, &c, customWidgets)
+
+	c.txtSearch.SetOnTextChanged(c.OnSearchChanged)
 
 	c.autoupdateOn = true
 	c.AddTimer(1000, c.timerUpdate)
 	c.updateAutoupdateButton()
 
-	c.filterType = "tcp"
+	// The main form applies the startup preset afterwards
+	defaults := system.DefaultFilterPreset()
+	c.filterType = defaults.Type
 	c.updateTypeButtons()
 	system.Instance.SetFilterType(c.filterType)
 
-	c.filterStatus = "LISTEN"
+	c.filterStatus = defaults.Status
 	c.updateStatusButtons()
 	system.Instance.SetFilterStatus(c.filterStatus)
 
+	c.filterNamespace = defaults.Namespace
+	c.updateNamespaceButtons()
+	system.Instance.SetFilterNamespace(c.filterNamespace)
+
 	btnEstablished, ok := c.FindWidgetByName("btnStatusEstablished").(*ui.Button)
 	if ok {
 		btnEstablished.SetMinWidth(150)
@@ -126,6 +212,14 @@ func (c *TopPanel) OnUdpClick() {
 	c.updateStatusButtons()
 }
 
+func (c *TopPanel) OnUnixClick() {
+	c.filterType = "unix"
+	system.Instance.SetFilterType(c.filterType)
+	c.updateTypeButtons()
+	c.EmitUpdateEvent()
+	c.updateStatusButtons()
+}
+
 func (c *TopPanel) OnAllClick() {
 	c.filterType = "all"
 	system.Instance.SetFilterType(c.filterType)
@@ -170,6 +264,179 @@ func (c *TopPanel) OnStatusAllClick() {
 	c.EmitUpdateEvent()
 }
 
+// The preset buttons act on the name in the box. The main form owns the
+// presets, as they cover the table settings too.
+
+func (c *TopPanel) OnPresetLoadClick() {
+	system.Instance.EmitEvent("preset_load", c.txtPreset.Text())
+}
+
+func (c *TopPanel) OnPresetSaveClick() {
+	system.Instance.EmitEvent("preset_save", c.txtPreset.Text())
+}
+
+func (c *TopPanel) OnPresetDefaultClick() {
+	system.Instance.EmitEvent("preset_default", c.txtPreset.Text())
+}
+
+func (c *TopPanel) OnPresetDeleteClick() {
+	system.Instance.EmitEvent("preset_delete", c.txtPreset.Text())
+}
+
+// SetPresetsText shows the saved presets or the outcome of an action
+func (c *TopPanel) SetPresetsText(text string) {
+	lblPresets, ok := c.FindWidgetByName("lblPresets").(*ui.Label)
+	if ok {
+		lblPresets.SetText(text)
+	}
+}
+
+// FillPreset stores the filters of the panel in the preset
+func (c *TopPanel) FillPreset(preset *system.FilterPreset) {
+	preset.Type = c.filterType
+	preset.Status = c.filterStatus
+	preset.Namespace = c.filterNamespace
+	preset.Query = system.Instance.GetFilterQueryText()
+}
+
+// ApplyPreset switches the filters to the preset. Unknown values fall back
+// to the defaults, an invalid query is dropped.
+func (c *TopPanel) ApplyPreset(preset system.FilterPreset) {
+	defaults := system.DefaultFilterPreset()
+	c.filterType = preset.Type
+	if !slices.Contains(system.FilterTypes, c.filterType) {
+		c.filterType = defaults.Type
+	}
+	c.filterStatus = preset.Status
+	if !slices.Contains(system.FilterStatuses, c.filterStatus) {
+		c.filterStatus = defaults.Status
+	}
+	system.Instance.SetFilterType(c.filterType)
+	system.Instance.SetFilterStatus(c.filterStatus)
+	c.updateTypeButtons()
+	c.updateStatusButtons()
+
+	namespace := preset.Namespace
+	if namespace == "" {
+		namespace = defaults.Namespace
+	}
+	c.setFilterNamespace(namespace)
+
+	query := preset.Query
+	if system.Instance.SetFilterQuery(query) != nil {
+		query = ""
+		system.Instance.SetFilterQuery(query)
+	}
+	c.txtSearch.SetText(query)
+	c.txtPreset.SetText(preset.Name)
+
+	// The center panel shows the columns of the preset
+	c.statsOn = preset.ShowsStats()
+	c.updateStatsButton()
+	c.EmitUpdateEvent()
+}
+
+// OnSearchChanged applies the query of the search box. An invalid query
+// is reported in place of the title and the previous one stays active.
+func (c *TopPanel) OnSearchChanged() {
+	lblSearch, ok := c.FindWidgetByName("lblSearch").(*ui.Label)
+	if err := system.Instance.SetFilterQuery(c.txtSearch.Text()); err != nil {
+		if ok {
+			lblSearch.SetText(err.Error())
+		}
+		return
+	}
+	if ok {
+		lblSearch.SetText("Search")
+	}
+	c.EmitUpdateEvent()
+}
+
+func (c *TopPanel) OnNamespaceHostClick() {
+	c.setFilterNamespace(system.NamespaceHost)
+}
+
+func (c *TopPanel) OnNamespaceOtherClick() {
+	c.setFilterNamespace(system.NamespaceOther)
+}
+
+func (c *TopPanel) OnNamespaceAllClick() {
+	c.setFilterNamespace(system.NamespaceAll)
+}
+
+// setFilterNamespace shows the sockets of the host network namespace,
+// of the other namespaces (containers) or of all of them
+func (c *TopPanel) setFilterNamespace(filterNamespace string) {
+	c.filterNamespace = filterNamespace
+	system.Instance.SetFilterNamespace(c.filterNamespace)
+	c.updateNamespaceButtons()
+	system.Instance.EmitEvent("netns", c.filterNamespace)
+	c.EmitUpdateEvent()
+}
+
+// OnStatsClick shows or hides the socket statistics columns
+func (c *TopPanel) OnStatsClick() {
+	c.statsOn = !c.statsOn
+	if c.statsOn {
+		system.Instance.EmitEvent("show_stats", "1")
+	} else {
+		system.Instance.EmitEvent("show_stats", "0")
+	}
+	c.updateStatsButton()
+}
+
+// OnGroupContainerClick groups the table by container or systemd unit
+func (c *TopPanel) OnGroupContainerClick() {
+	c.toggleGroupBy("container")
+}
+
+// OnGroupProcessClick groups the table by process tree
+func (c *TopPanel) OnGroupProcessClick() {
+	c.toggleGroupBy("process")
+}
+
+// toggleGroupBy switches to the grouping, or back to the flat list when
+// it is already active
+func (c *TopPanel) toggleGroupBy(groupBy string) {
+	if c.groupBy == groupBy {
+		c.groupBy = ""
+	} else {
+		c.groupBy = groupBy
+	}
+	system.Instance.EmitEvent("group_by", c.groupBy)
+	c.updateGroupButtons()
+}
+
+func (c *TopPanel) updateGroupButtons() {
+	buttons := map[string]string{
+		"btnGroupContainer": "container",
+		"btnGroupProcess":   "process",
+	}
+	for name, groupBy := range buttons {
+		btn, ok := c.FindWidgetByName(name).(*ui.Button)
+		if !ok {
+			continue
+		}
+		if c.groupBy == groupBy {
+			btn.SetRole("primary")
+		} else {
+			btn.SetRole("")
+		}
+	}
+}
+
+func (c *TopPanel) updateStatsButton() {
+	btnStats, ok := c.FindWidgetByName("btnStats").(*ui.Button)
+	if !ok {
+		return
+	}
+	if c.statsOn {
+		btnStats.SetRole("primary")
+	} else {
+		btnStats.SetRole("")
+	}
+}
+
 func (c *TopPanel) updateAutoupdateButton() {
 	btnAutoupdate, ok := c.FindWidgetByName("btnAutoupdate").(*ui.Button)
 	if !ok {
@@ -201,6 +468,15 @@ func (c *TopPanel) updateTypeButtons() {
 		}
 	}
 
+	btnUnix, ok := c.FindWidgetByName("btnUnix").(*ui.Button)
+	if ok {
+		if c.filterType == "unix" {
+			btnUnix.SetRole("primary")
+		} else {
+			btnUnix.SetRole("")
+		}
+	}
+
 	btnAll, ok := c.FindWidgetByName("btnAll").(*ui.Button)
 	if ok {
 		if c.filterType == "all" {
@@ -211,6 +487,25 @@ func (c *TopPanel) updateTypeButtons() {
 	}
 }
 
+func (c *TopPanel) updateNamespaceButtons() {
+	buttons := map[string]string{
+		"btnNamespaceHost":  system.NamespaceHost,
+		"btnNamespaceOther": system.NamespaceOther,
+		"btnNamespaceAll":   system.NamespaceAll,
+	}
+	for name, filterNamespace := range buttons {
+		btn, ok := c.FindWidgetByName(name).(*ui.Button)
+		if !ok {
+			continue
+		}
+		if c.filterNamespace == filterNamespace {
+			btn.SetRole("primary")
+		} else {
+			btn.SetRole("")
+		}
+	}
+}
+
 func (c *TopPanel) updateStatusButtons() {
 	btnListen, ok := c.FindWidgetByName("btnStatusListen").(*ui.Button)
 	if !ok {
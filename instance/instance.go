@@ -0,0 +1,162 @@
+package instance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/localstorage"
+)
+
+const (
+	lockFileName   = "instance.lock"
+	socketFileName = "instance.sock"
+
+	forwardTimeout = 3 * time.Second
+)
+
+// forwardRetryTime is how long Forward tries to connect. The instance
+// takes the lock before it listens, so a launch right after it may find
+// no socket yet.
+var forwardRetryTime = 2 * time.Second
+
+// ErrRunning is returned by Acquire when another window is open
+var ErrRunning = errors.New("another instance is running")
+
+// Instance is the lock and the command socket of the running window
+type Instance struct {
+	release  func()
+	listener net.Listener
+	handler  func(args []string) error
+}
+
+// request is one line sent over the socket, answered by a response line
+type request struct {
+	Args []string `json:"args"`
+}
+
+type response struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Acquire makes this process the running instance. It locks
+// instance.lock in the local storage and listens on instance.sock next to
+// it; the command lines forwarded by later launches are passed to
+// handler, on the goroutine of the socket.
+func Acquire(handler func(args []string) error) (*Instance, error) {
+	release, err := localstorage.TryLock(lockFileName)
+	if errors.Is(err, localstorage.ErrLocked) {
+		return nil, ErrRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Holding the lock, a socket left by a crashed instance is stale
+	socketPath := filepath.Join(localstorage.Path(), socketFileName)
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	var c Instance
+	c.release = release
+	c.listener = listener
+	c.handler = handler
+	go c.thServe()
+	return &c, nil
+}
+
+// Close stops listening and releases the lock
+func (c *Instance) Close() {
+	c.listener.Close()
+	c.release()
+}
+
+func (c *Instance) thServe() {
+	for {
+		conn, err := c.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Println("instance socket:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go c.serveConn(conn)
+	}
+}
+
+func (c *Instance) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	var req request
+	var resp response
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err == nil {
+		err = c.handler(req.Args)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	data, _ := json.Marshal(resp)
+	conn.Write(append(data, '\n'))
+}
+
+// Forward passes the command line to the running instance and waits for
+// it to be accepted
+func Forward(args []string) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	data, err := json.Marshal(request{Args: args})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("running instance: %s", resp.Error)
+	}
+	return nil
+}
+
+// dial connects to the socket of the running instance, retrying for
+// forwardRetryTime
+func dial() (net.Conn, error) {
+	socketPath := filepath.Join(localstorage.Path(), socketFileName)
+	deadline := time.Now().Add(forwardRetryTime)
+	for {
+		conn, err := net.DialTimeout("unix", socketPath, forwardTimeout)
+		if err == nil || time.Now().After(deadline) {
+			return conn, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,101 @@
+package instance
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/u00io/localports/localstorage"
+)
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "instance")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("USERPROFILE", home)
+	localstorage.Init("localports")
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func TestForward(t *testing.T) {
+	received := make(chan []string, 1)
+	first, err := Acquire(func(args []string) error {
+		if slices.Contains(args, "--bad") {
+			return errors.New("unknown flag")
+		}
+		received <- args
+		return nil
+	})
+	if err != nil {
+		t.Skip("can not listen:", err)
+	}
+	defer first.Close()
+
+	if _, err := Acquire(nil); !errors.Is(err, ErrRunning) {
+		t.Fatalf("second Acquire: %v, want %v", err, ErrRunning)
+	}
+	if err := Forward([]string{"--port", "8080"}); err != nil {
+		t.Fatal(err)
+	}
+	if args := <-received; !slices.Equal(args, []string{"--port", "8080"}) {
+		t.Errorf("received %v", args)
+	}
+	if err := Forward([]string{"--bad"}); err == nil {
+		t.Error("the error of the running instance was lost")
+	}
+}
+
+func TestForwardBeforeListen(t *testing.T) {
+	release, err := localstorage.TryLock(lockFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// The running instance took the lock and listens a moment later
+	received := make(chan []string, 1)
+	socketPath := filepath.Join(localstorage.Path(), socketFileName)
+	os.Remove(socketPath)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return
+		}
+		c := &Instance{release: func() {}, listener: listener, handler: func(args []string) error {
+			received <- args
+			return nil
+		}}
+		t.Cleanup(c.Close)
+		go c.thServe()
+	}()
+
+	if err := Forward([]string{"--query", "nginx"}); err != nil {
+		t.Fatal(err)
+	}
+	if args := <-received; !slices.Equal(args, []string{"--query", "nginx"}) {
+		t.Errorf("received %v", args)
+	}
+}
+
+func TestForwardWithoutInstance(t *testing.T) {
+	os.Remove(filepath.Join(localstorage.Path(), socketFileName))
+	defer func(d time.Duration) { forwardRetryTime = d }(forwardRetryTime)
+	forwardRetryTime = 200 * time.Millisecond
+
+	start := time.Now()
+	if err := Forward(nil); err == nil {
+		t.Fatal("Forward without a running instance succeeded")
+	}
+	if elapsed := time.Since(start); elapsed < forwardRetryTime {
+		t.Errorf("gave up after %v", elapsed)
+	}
+}
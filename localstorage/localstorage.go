@@ -1,10 +1,25 @@
 package localstorage
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// lockFileName is the advisory lock of the storage directory, held while
+// a file is written or deleted so that two instances don't interleave
+const lockFileName = ".lock"
+
+// tempSuffix marks the temporary files of WriteFileAtomic
+const tempSuffix = ".tmp-"
+
+// ErrLocked is returned by TryLock when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
 var mtx sync.Mutex
 var path string
 
@@ -19,7 +34,11 @@ func Init(programName string) {
 	homeDir := homeDirectory()
 	path = homeDir + "/." + programName
 
-	os.MkdirAll(path, 0600)
+	os.MkdirAll(path, 0700)
+	// Older versions created the directory without the search bit
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0100 == 0 {
+		os.Chmod(path, 0700)
+	}
 }
 
 func Path() string {
@@ -28,21 +47,64 @@ func Path() string {
 	return path
 }
 
+// resolve returns the path of a name in the storage directory. Names may
+// contain subdirectories ("history/2024.jsonl") but must stay inside it.
+func resolve(fileName string) (string, error) {
+	if path == "" {
+		return "", errors.New("local storage is not initialized")
+	}
+	if !filepath.IsLocal(fileName) {
+		return "", fmt.Errorf("invalid local storage name: %q", fileName)
+	}
+	return filepath.Join(path, fileName), nil
+}
+
+// Write replaces the file atomically, creating its subdirectory when
+// needed. The storage directory is locked while writing.
 func Write(fileName string, data []byte) error {
 	mtx.Lock()
 	defer mtx.Unlock()
-	filePath := path + "/" + fileName
-	err := os.WriteFile(filePath, data, 0600)
+	filePath, err := resolve(fileName)
 	if err != nil {
 		return err
 	}
-	return nil
+	unlock, err := lockDirectory(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return WriteFileAtomic(filePath, data, 0600)
+}
+
+// WritePath is Write for a file given by its path, like a settings file
+// chosen with --config. A file inside the storage directory takes its
+// lock; any other file is only replaced atomically.
+func WritePath(filePath string, data []byte) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if path != "" {
+		abs, err := filepath.Abs(filePath)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(path, abs); err == nil && filepath.IsLocal(rel) {
+			unlock, err := lockDirectory(path)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+	}
+	return WriteFileAtomic(filePath, data, 0600)
 }
 
 func Read(fileName string) ([]byte, error) {
 	mtx.Lock()
 	defer mtx.Unlock()
-	filePath := path + "/" + fileName
+	filePath, err := resolve(fileName)
+	if err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
@@ -53,7 +115,116 @@ func Read(fileName string) ([]byte, error) {
 func Exists(fileName string) bool {
 	mtx.Lock()
 	defer mtx.Unlock()
-	filePath := path + "/" + fileName
-	_, err := os.Stat(filePath)
+	filePath, err := resolve(fileName)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filePath)
 	return !os.IsNotExist(err)
 }
+
+// Delete removes a file. Deleting a missing file is not an error.
+func Delete(fileName string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	filePath, err := resolve(fileName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockDirectory(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// TryLock takes an exclusive lock on a file of the storage without
+// waiting. The lock is held until the returned function is called or the
+// process exits.
+func TryLock(fileName string) (func(), error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	filePath, err := resolve(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(filePath, false)
+}
+
+// List returns the sorted names of the files in a subdirectory, "" for
+// the storage directory itself. Subdirectories, sockets, locks and
+// temporary files are left out; a missing subdirectory is empty.
+func List(subdir string) ([]string, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	dirPath := path
+	if subdir != "" {
+		var err error
+		dirPath, err = resolve(subdir)
+		if err != nil {
+			return nil, err
+		}
+	} else if path == "" {
+		return nil, errors.New("local storage is not initialized")
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, ".lock") || strings.Contains(name, tempSuffix) {
+			continue
+		}
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// WriteFileAtomic writes to a temporary file in the same directory,
+// flushes it to disk and renames it over filePath, so a crash leaves
+// either the old or the new content. Missing directories are created.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(filePath)+tempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	syncDirectory(dir)
+	return nil
+}
@@ -0,0 +1,90 @@
+package localstorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "localstorage")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("USERPROFILE", home)
+	Init("localports")
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// writeWhileLocked starts write while the storage lock is held by someone
+// else and reports whether it waited for the lock
+func writeWhileLocked(t *testing.T, write func() error) bool {
+	t.Helper()
+	unlock, err := lockFile(filepath.Join(Path(), lockFileName), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- write() }()
+
+	select {
+	case err := <-done:
+		unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return false
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+func TestWriteTakesLock(t *testing.T) {
+	if !writeWhileLocked(t, func() error { return Write("a.json", []byte("{}")) }) {
+		t.Error("Write did not wait for the lock")
+	}
+	inside := filepath.Join(Path(), "settings.json")
+	if !writeWhileLocked(t, func() error { return WritePath(inside, []byte("{}")) }) {
+		t.Error("WritePath in the storage did not wait for the lock")
+	}
+	outside := filepath.Join(t.TempDir(), "settings.json")
+	if writeWhileLocked(t, func() error { return WritePath(outside, []byte("{}")) }) {
+		t.Error("WritePath outside the storage waited for its lock")
+	}
+
+	for _, name := range []string{inside, outside} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != "{}" {
+			t.Errorf("%s: %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	for _, name := range []string{"history/2024-01-02.jsonl", "history/2024-01-01.jsonl"} {
+		if err := Write(name, []byte("\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Temporary files and locks are left out
+	os.WriteFile(filepath.Join(Path(), "history", "x.jsonl"+tempSuffix+"1"), nil, 0600)
+	os.WriteFile(filepath.Join(Path(), "history", "day.lock"), nil, 0600)
+
+	names, err := List("history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "2024-01-01.jsonl" || names[1] != "2024-01-02.jsonl" {
+		t.Errorf("List = %v", names)
+	}
+	if _, err := Read("../escape"); err == nil {
+		t.Error("Read outside the storage succeeded")
+	}
+}
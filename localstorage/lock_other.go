@@ -0,0 +1,49 @@
+//go:build !windows
+
+package localstorage
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDirectory takes the advisory lock of the directory, waiting for
+// other processes holding it
+func lockDirectory(dir string) (func(), error) {
+	return lockFile(filepath.Join(dir, lockFileName), true)
+}
+
+// lockFile takes an exclusive advisory lock on the file. Without wait it
+// fails with ErrLocked when another process holds it.
+func lockFile(filePath string, wait bool) (func(), error) {
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// syncDirectory flushes a rename to disk
+func syncDirectory(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
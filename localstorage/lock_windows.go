@@ -0,0 +1,43 @@
+package localstorage
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockDirectory takes the advisory lock of the directory, waiting for
+// other processes holding it
+func lockDirectory(dir string) (func(), error) {
+	return lockFile(filepath.Join(dir, lockFileName), true)
+}
+
+// lockFile takes an exclusive lock on the file. Without wait it fails
+// with ErrLocked when another process holds it.
+func lockFile(filePath string, wait bool) (func(), error) {
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	var overlapped windows.Overlapped
+	handle := windows.Handle(f.Fd())
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	if err := windows.LockFileEx(handle, flags, 0, 1, 0, &overlapped); err != nil {
+		f.Close()
+		if err == windows.ERROR_LOCK_VIOLATION {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return func() {
+		windows.UnlockFileEx(handle, 0, 1, 0, &overlapped)
+		f.Close()
+	}, nil
+}
+
+// syncDirectory does nothing, NTFS renames don't need a directory flush
+func syncDirectory(dir string) {}
@@ -1,13 +1,86 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/api"
+	"github.com/u00io/localports/cli"
 	"github.com/u00io/localports/forms/mainform"
+	"github.com/u00io/localports/instance"
 	"github.com/u00io/localports/localstorage"
+	"github.com/u00io/localports/settings"
+	"github.com/u00io/localports/system"
 )
 
 func main() {
 	localstorage.Init("localports")
 	logger.Init(localstorage.Path() + "/logs")
-	mainform.Run()
+
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	flags, err := cli.ParseGUIFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+
+	// A second launch hands its filter to the open window and exits. It
+	// never opens a second window, also when the first one doesn't answer.
+	single, err := instance.Acquire(onForward)
+	if errors.Is(err, instance.ErrRunning) {
+		err = instance.Forward(os.Args[1:])
+		if err == nil {
+			return
+		}
+		logger.Println("can not forward to the running instance:", err)
+		fmt.Fprintln(os.Stderr, "localports is already running, can not pass the command line to it:", err)
+		os.Exit(1)
+	} else if err != nil {
+		logger.Println("single instance:", err)
+	}
+	if single != nil {
+		defer single.Close()
+	}
+	if filter, ok := flags.Filter(); ok {
+		mainform.ShowFilter(filter)
+	}
+
+	settings.Init(flags.Config)
+	system.SetDockerSocket(flags.DockerSocket)
+
+	collector, err := system.SelectCollector(flags.Collector)
+	if err != nil {
+		logger.Println(err)
+		collector = system.DefaultCollector()
+	}
+
+	// The API handlers name processes through system.Instance, so it must
+	// exist and know the processes before the first request
+	system.Instance = system.NewSystem()
+	system.Instance.UpdateProcesses()
+	system.Instance.Start()
+
+	if flags.APIPort != 0 {
+		server := api.NewServer(collector, flags.APIPort, flags.APIToken)
+		if err := server.Start(); err != nil {
+			logger.Println("can not start api server:", err)
+		}
+	}
+
+	mainform.Run(collector)
+}
+
+// onForward applies the command line of a later launch
+func onForward(args []string) error {
+	flags, err := cli.ParseGUIFlags(args)
+	if err != nil {
+		return err
+	}
+	filter, _ := flags.Filter()
+	mainform.ShowFilter(filter)
+	return nil
 }
@@ -0,0 +1,305 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+	"github.com/u00io/localports/localstorage"
+	"github.com/u00io/localports/system"
+)
+
+// SchemaVersion is the version of the settings file written by this build
+const SchemaVersion = 2
+
+// ConfigEnv overrides the location of the settings file, like --config
+const ConfigEnv = "LOCALPORTS_CONFIG"
+
+// fileName is the settings file in the local storage
+const fileName = "settings.json"
+
+// Settings are the user preferences of the window. Zero values are
+// replaced by the defaults when the file is read.
+type Settings struct {
+	Version int `json:"version"`
+
+	WindowWidth  int `json:"window_width"`
+	WindowHeight int `json:"window_height"`
+
+	// RefreshIntervalMs is how often the connections are collected
+	RefreshIntervalMs int `json:"refresh_interval_ms"`
+
+	ColumnWidths map[string]int `json:"column_widths"` // By column key
+	SortColumn   string         `json:"sort_column"`
+	SortAsc      bool           `json:"sort_asc"`
+
+	// How long new rows are highlighted and closed rows stay in the
+	// table, 0 turns it off
+	HighlightMs    int `json:"highlight_ms"`
+	ClosedLingerMs int `json:"closed_linger_ms"`
+
+	NewRowColor    string `json:"new_row_color"` // #RRGGBB
+	ClosedRowColor string `json:"closed_row_color"`
+}
+
+// Defaults are used for the fields missing in the file
+func Defaults() Settings {
+	return Settings{
+		Version:           SchemaVersion,
+		WindowWidth:       1300,
+		WindowHeight:      800,
+		RefreshIntervalMs: 1000,
+		ColumnWidths:      map[string]int{},
+		SortColumn:        system.ColumnLocalPort,
+		SortAsc:           true,
+		HighlightMs:       3000,
+		ClosedLingerMs:    5000,
+		NewRowColor:       "#81C784",
+		ClosedRowColor:    "#464646",
+	}
+}
+
+// RefreshInterval returns RefreshIntervalMs as a duration
+func (s Settings) RefreshInterval() time.Duration {
+	return time.Duration(s.RefreshIntervalMs) * time.Millisecond
+}
+
+// HighlightDuration returns HighlightMs as a duration
+func (s Settings) HighlightDuration() time.Duration {
+	return time.Duration(s.HighlightMs) * time.Millisecond
+}
+
+// ClosedLinger returns ClosedLingerMs as a duration
+func (s Settings) ClosedLinger() time.Duration {
+	return time.Duration(s.ClosedLingerMs) * time.Millisecond
+}
+
+// clone copies the map, so callers can't change the stored settings
+func (s Settings) clone() Settings {
+	widths := make(map[string]int, len(s.ColumnWidths))
+	for key, width := range s.ColumnWidths {
+		widths[key] = width
+	}
+	s.ColumnWidths = widths
+	return s
+}
+
+// normalize replaces missing and invalid values by the defaults
+func (s *Settings) normalize() {
+	defaults := Defaults()
+	if s.WindowWidth <= 0 || s.WindowHeight <= 0 {
+		s.WindowWidth = defaults.WindowWidth
+		s.WindowHeight = defaults.WindowHeight
+	}
+	// Collecting more often than every 100 ms only burns CPU
+	if s.RefreshIntervalMs < 100 {
+		s.RefreshIntervalMs = defaults.RefreshIntervalMs
+	}
+	if s.ColumnWidths == nil {
+		s.ColumnWidths = map[string]int{}
+	}
+	if s.SortColumn == "" {
+		s.SortColumn = defaults.SortColumn
+	}
+	if s.HighlightMs < 0 {
+		s.HighlightMs = defaults.HighlightMs
+	}
+	if s.ClosedLingerMs < 0 {
+		s.ClosedLingerMs = defaults.ClosedLingerMs
+	}
+	if !isHexColor(s.NewRowColor) {
+		s.NewRowColor = defaults.NewRowColor
+	}
+	if !isHexColor(s.ClosedRowColor) {
+		s.ClosedRowColor = defaults.ClosedRowColor
+	}
+}
+
+// isHexColor accepts colors written as #RRGGBB
+func isHexColor(s string) bool {
+	if len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// migrations upgrade the raw document of version i to i+1
+var migrations = []func(doc map[string]any){
+	// 0 -> 1: the first versioned file, nothing to convert
+	func(doc map[string]any) {},
+	// 1 -> 2: row highlighting became configurable, with the values that
+	// were built in before
+	func(doc map[string]any) {
+		defaults := Defaults()
+		setDefault(doc, "highlight_ms", defaults.HighlightMs)
+		setDefault(doc, "closed_linger_ms", defaults.ClosedLingerMs)
+		setDefault(doc, "new_row_color", defaults.NewRowColor)
+		setDefault(doc, "closed_row_color", defaults.ClosedRowColor)
+	},
+}
+
+func setDefault(doc map[string]any, key string, value any) {
+	if _, ok := doc[key]; !ok {
+		doc[key] = value
+	}
+}
+
+// ErrTooNew is returned when saving over a file written by a newer
+// version, which would lose the fields this version doesn't know
+var ErrTooNew = errors.New("settings were saved by a newer version")
+
+var mtx sync.Mutex
+
+// saveMtx is held from the change to the end of the write, so the file
+// always ends up with the last update
+var saveMtx sync.Mutex
+
+var path string
+var current = Defaults()
+var subscribers = make(map[int]func(Settings))
+var nextSubscriber int
+
+// Init loads the settings from configPath, from $LOCALPORTS_CONFIG or
+// from settings.json in the local storage, in that order. A missing or
+// damaged file gives the defaults. A missing file is created, so there is
+// something to edit; a damaged one is logged and replaced on the next save.
+func Init(configPath string) {
+	if configPath == "" {
+		configPath = os.Getenv(ConfigEnv)
+	}
+	if configPath == "" {
+		configPath = filepath.Join(localstorage.Path(), fileName)
+	}
+
+	loaded, err := load(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := save(configPath, loaded); err != nil {
+			logger.Println("can not write settings:", err)
+		}
+	} else if err != nil {
+		logger.Println("can not read settings:", err)
+	}
+
+	mtx.Lock()
+	path = configPath
+	current = loaded
+	mtx.Unlock()
+}
+
+// Path returns the settings file in use
+func Path() string {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return path
+}
+
+func load(fileName string) (Settings, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return Defaults(), err
+	}
+	s, err := parse(data)
+	if err != nil {
+		return Defaults(), fmt.Errorf("%s: %w", fileName, err)
+	}
+	return s, nil
+}
+
+func parse(data []byte) (Settings, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Settings{}, err
+	}
+	version := 0
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	for ; version < SchemaVersion && version < len(migrations); version++ {
+		migrations[version](doc)
+	}
+	doc["version"] = max(version, SchemaVersion)
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return Settings{}, err
+	}
+	s := Defaults()
+	if err := json.Unmarshal(migrated, &s); err != nil {
+		return Settings{}, err
+	}
+	s.normalize()
+	return s, nil
+}
+
+// Get returns a copy of the current settings
+func Get() Settings {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return current.clone()
+}
+
+// Update changes the settings, saves them and notifies the subscribers.
+// The change is kept in memory even when saving fails.
+func Update(change func(s *Settings)) error {
+	saveMtx.Lock()
+	mtx.Lock()
+	s := current.clone()
+	change(&s)
+	s.normalize()
+	if s.Version < SchemaVersion {
+		s.Version = SchemaVersion
+	}
+	current = s
+	fileName := path
+	notify := make([]func(Settings), 0, len(subscribers))
+	for _, f := range subscribers {
+		notify = append(notify, f)
+	}
+	mtx.Unlock()
+
+	err := save(fileName, s)
+	saveMtx.Unlock()
+	for _, f := range notify {
+		f(s.clone())
+	}
+	return err
+}
+
+// Subscribe calls f with the new settings after every Update. The
+// returned function removes the subscription.
+func Subscribe(f func(s Settings)) func() {
+	mtx.Lock()
+	defer mtx.Unlock()
+	id := nextSubscriber
+	nextSubscriber++
+	subscribers[id] = f
+	return func() {
+		mtx.Lock()
+		defer mtx.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+func save(fileName string, s Settings) error {
+	if fileName == "" {
+		return errors.New("settings are not initialized")
+	}
+	if s.Version > SchemaVersion {
+		return ErrTooNew
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return localstorage.WritePath(fileName, data)
+}
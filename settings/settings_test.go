@@ -0,0 +1,100 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// initTemp starts the tests with the defaults in a temporary file
+func initTemp(t *testing.T) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "settings.json")
+	Init(fileName)
+	return fileName
+}
+
+func TestInitCreatesFile(t *testing.T) {
+	fileName := initTemp(t)
+	s, err := load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(s) != fmt.Sprint(Defaults()) {
+		t.Errorf("saved %+v, want the defaults", s)
+	}
+}
+
+func TestUpdateKeepsLastOnDisk(t *testing.T) {
+	fileName := initTemp(t)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Update(func(s *Settings) {
+				s.WindowWidth = i * 10
+				s.ColumnWidths[fmt.Sprint(i)] = i
+			})
+		}()
+	}
+	wg.Wait()
+
+	saved, err := load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(saved) != fmt.Sprint(Get()) {
+		t.Errorf("file has %+v, memory %+v", saved, Get())
+	}
+	if len(saved.ColumnWidths) != 50 {
+		t.Errorf("file has %d column widths, want 50", len(saved.ColumnWidths))
+	}
+}
+
+func TestUpdateKeepsNewerFile(t *testing.T) {
+	fileName := initTemp(t)
+	if err := os.WriteFile(fileName, []byte(`{"version": 99, "window_width": 640, "window_height": 480}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	Init(fileName)
+	if err := Update(func(s *Settings) { s.SortAsc = false }); err != ErrTooNew {
+		t.Errorf("Update over a newer file: %v, want %v", err, ErrTooNew)
+	}
+	data, _ := os.ReadFile(fileName)
+	if s, _ := parse(data); s.Version != 99 || s.WindowWidth != 640 {
+		t.Errorf("newer file was replaced: %s", data)
+	}
+}
+
+func TestParseMigratesVersion1(t *testing.T) {
+	s, err := parse([]byte(`{"version": 1, "window_width": 640, "window_height": 480, "sort_column": "program"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := Defaults()
+	if s.Version != SchemaVersion || s.WindowWidth != 640 || s.SortColumn != "program" {
+		t.Errorf("migrated %+v", s)
+	}
+	if s.HighlightMs != defaults.HighlightMs || s.ClosedLingerMs != defaults.ClosedLingerMs ||
+		s.NewRowColor != defaults.NewRowColor || s.ClosedRowColor != defaults.ClosedRowColor {
+		t.Errorf("highlighting of a version 1 file = %+v, want the defaults", s)
+	}
+}
+
+func TestNormalizeHighlight(t *testing.T) {
+	s, err := parse([]byte(`{"version": 2, "highlight_ms": 0, "closed_linger_ms": -1, "new_row_color": "green", "closed_row_color": "#2a2a2A"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := Defaults()
+	if s.HighlightMs != 0 {
+		t.Errorf("highlight_ms 0 became %d, it turns highlighting off", s.HighlightMs)
+	}
+	if s.ClosedLingerMs != defaults.ClosedLingerMs || s.NewRowColor != defaults.NewRowColor || s.ClosedRowColor != "#2a2a2A" {
+		t.Errorf("normalized %+v", s)
+	}
+}
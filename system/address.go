@@ -0,0 +1,83 @@
+package system
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// addr6ToString formats a raw IPv6 address. The zone is only kept for
+// link-local addresses, and IPv4-mapped addresses are shown as IPv4.
+func addr6ToString(addr [16]byte, zone string) string {
+	ip := netip.AddrFrom16(addr)
+	if ip.Is4In6() {
+		return ip.Unmap().String()
+	}
+	if zone != "" && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+		ip = ip.WithZone(zone)
+	}
+	return ip.String()
+}
+
+// ParseAddr parses an address as stored in ConnectionInfo. Brackets are
+// accepted and IPv4-mapped IPv6 addresses are converted to IPv4.
+func ParseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// FormatAddress renders IPv6 addresses in bracketed form ([::1]) so they
+// can't be confused with a port suffix. Other values are returned as is.
+func FormatAddress(s string) string {
+	ip, ok := ParseAddr(s)
+	if !ok || !ip.Is6() {
+		return s
+	}
+	return "[" + ip.String() + "]"
+}
+
+// FormatEndpoint renders address and port as 1.2.3.4:80 or [::1]:80
+func FormatEndpoint(addr string, port uint16) string {
+	ip, ok := ParseAddr(addr)
+	if !ok {
+		return addr
+	}
+	return netip.AddrPortFrom(ip, port).String()
+}
+
+// CompareAddresses orders addresses numerically, IPv4 before IPv6.
+// Values that are not IP addresses are compared as strings after them.
+func CompareAddresses(a string, b string) int {
+	ipA, okA := ParseAddr(a)
+	ipB, okB := ParseAddr(b)
+	if okA && okB {
+		return ipA.Compare(ipB)
+	}
+	if okA != okB {
+		if okA {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isLocalAreaNetwork(s string) bool {
+	ip, ok := ParseAddr(s)
+	if !ok {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+func isLoopbackOrUnspecified(s string) bool {
+	ip, ok := ParseAddr(s)
+	if !ok {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsUnspecified()
+}
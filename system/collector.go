@@ -1,75 +1,120 @@
 package system
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"unsafe"
-
-	"golang.org/x/sys/windows"
-)
-
-const (
-	AF_INET                 = 2
-	TCP_TABLE_OWNER_PID_ALL = 5
-	UDP_TABLE_OWNER_PID     = 1
-	MIB_TCP_STATE_LISTEN    = 2
+	"os"
+	"sort"
+	"sync"
 )
 
 // --------------------
-// WinAPI structs
+// Collector
 // --------------------
 
-type MIB_TCPROW_OWNER_PID struct {
-	State      uint32
-	LocalAddr  uint32
-	LocalPort  uint32
-	RemoteAddr uint32
-	RemotePort uint32
-	OwningPid  uint32
+// Collector takes snapshots of the network connections of the host
+type Collector interface {
+	Name() string
+	Snapshot(ctx context.Context) (NetworkConnections, error)
 }
 
-type MIB_TCPTABLE_OWNER_PID struct {
-	NumEntries uint32
-	Table      [1]MIB_TCPROW_OWNER_PID
+// FilteringCollector is implemented by collectors that can apply the type
+// and status filters at the source instead of after the snapshot
+type FilteringCollector interface {
+	Collector
+	SnapshotFiltered(ctx context.Context, filterType string, filterStatus string) (NetworkConnections, error)
 }
 
-type MIB_UDPROW_OWNER_PID struct {
-	LocalAddr uint32
-	LocalPort uint32
-	OwningPid uint32
+// SnapshotFiltered takes a snapshot and applies MatchFilter, letting the
+// collector skip filtered sockets when it supports that
+func SnapshotFiltered(ctx context.Context, collector Collector, filterType string, filterStatus string) ([]ConnectionInfo, error) {
+	var snapshot NetworkConnections
+	var err error
+	if fc, ok := collector.(FilteringCollector); ok {
+		snapshot, err = fc.SnapshotFiltered(ctx, filterType, filterStatus)
+	} else {
+		snapshot, err = collector.Snapshot(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return FilterConnections(snapshot.Connections, filterType, filterStatus), nil
 }
 
-type MIB_UDPTABLE_OWNER_PID struct {
-	NumEntries uint32
-	Table      [1]MIB_UDPROW_OWNER_PID
+var ErrNoCollector = errors.New("no connection collector for this platform")
+
+var collectorsMtx sync.Mutex
+var collectorFactories = make(map[string]func() Collector)
+var collectorNames []string
+
+// RegisterCollector makes a collector available by name
+func RegisterCollector(name string, factory func() Collector) {
+	collectorsMtx.Lock()
+	defer collectorsMtx.Unlock()
+	if _, exists := collectorFactories[name]; !exists {
+		collectorNames = append(collectorNames, name)
+	}
+	collectorFactories[name] = factory
 }
 
-// --------------------
-// DLL imports
-// --------------------
+func CollectorNames() []string {
+	collectorsMtx.Lock()
+	defer collectorsMtx.Unlock()
+	result := make([]string, len(collectorNames))
+	copy(result, collectorNames)
+	sort.Strings(result)
+	return result
+}
 
-var (
-	modiphlpapi             = windows.NewLazySystemDLL("iphlpapi.dll")
-	procGetExtendedTcpTable = modiphlpapi.NewProc("GetExtendedTcpTable")
-	procGetExtendedUdpTable = modiphlpapi.NewProc("GetExtendedUdpTable")
-)
+func NewCollector(name string) (Collector, error) {
+	collectorsMtx.Lock()
+	factory, ok := collectorFactories[name]
+	collectorsMtx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown collector: %s", name)
+	}
+	return factory(), nil
+}
 
-// --------------------
-// Helpers
-// --------------------
+// DefaultCollector returns the preferred collector of the platform, named
+// by defaultCollectorName in the platform files
+func DefaultCollector() Collector {
+	collectorsMtx.Lock()
+	factory := collectorFactories[defaultCollectorName]
+	collectorsMtx.Unlock()
+	if factory == nil {
+		return &unsupportedCollector{}
+	}
+	return factory()
+}
 
-func ntohs(port uint32) uint16 {
-	p := uint16(port & 0xFFFF)
-	return (p >> 8) | (p << 8)
+// SelectCollector returns the named collector. An empty name means
+// $LOCALPORTS_COLLECTOR, and the default collector when that is not set.
+func SelectCollector(name string) (Collector, error) {
+	if name == "" {
+		name = os.Getenv("LOCALPORTS_COLLECTOR")
+	}
+	if name == "" {
+		return DefaultCollector(), nil
+	}
+	return NewCollector(name)
 }
 
-func addrToString(addr uint32) string {
-	return fmt.Sprintf("%d.%d.%d.%d",
-		byte(addr),
-		byte(addr>>8),
-		byte(addr>>16),
-		byte(addr>>24))
+type unsupportedCollector struct{}
+
+func (c *unsupportedCollector) Name() string {
+	return "unsupported"
 }
 
+func (c *unsupportedCollector) Snapshot(ctx context.Context) (NetworkConnections, error) {
+	return NetworkConnections{}, ErrNoCollector
+}
+
+// --------------------
+// Helpers
+// --------------------
+
 func tcpStateToString(state uint32) string {
 	switch state {
 	case 1:
@@ -102,6 +147,9 @@ func tcpStateToString(state uint32) string {
 }
 
 func processName(pid uint32) string {
+	if Instance == nil {
+		return "?"
+	}
 	return Instance.GetProcessName(pid)
 }
 
@@ -109,228 +157,27 @@ func processName(pid uint32) string {
 // Data model
 // --------------------
 
-type ProcInfo struct {
-	PID  uint32
-	Name string
-}
-
-type PortMap map[uint16][]ProcInfo
-
 // ConnectionInfo contains detailed information about a single network connection
 type ConnectionInfo struct {
-	Protocol    string // "TCP" or "UDP"
-	LocalAddr   string // Local side IP address
+	Protocol    string // "TCP", "UDP" or "UNIX"
+	SocketType  string // "STREAM", "DGRAM" or "SEQPACKET" (for UNIX)
+	LocalAddr   string // Local side IP address, or the path of a UNIX socket
 	LocalPort   uint16 // Local side port
 	RemoteAddr  string // Remote side IP address (for TCP)
 	RemotePort  uint16 // Remote side port (for TCP)
 	State       string // Connection state (for TCP)
 	PID         uint32 // Process ID
 	ProcessName string // Process name
+
+	Inode uint64 // Socket inode (Linux), tells a reused tuple apart
+	NetNS uint64 // Network namespace inode (Linux), 0 when unknown
+
+	Process ProcessInfo      // Details of the owning process
+	Stats   *ConnectionStats // Socket counters, nil when the collector has none
+	Rates   *ConnectionRates // Transfer rates, nil until measured over two snapshots
 }
 
 // NetworkConnections contains all network connections
 type NetworkConnections struct {
 	Connections []ConnectionInfo
 }
-
-// --------------------
-// Collectors
-// --------------------
-
-func collectTCP() PortMap {
-	ports := make(PortMap)
-
-	var size uint32
-	procGetExtendedTcpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-
-	buf := make([]byte, size)
-	ret, _, _ := procGetExtendedTcpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 {
-		return ports
-	}
-
-	table := (*MIB_TCPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
-	rows := (*[1 << 20]MIB_TCPROW_OWNER_PID)(
-		unsafe.Pointer(&table.Table[0]),
-	)[:table.NumEntries:table.NumEntries]
-
-	for _, row := range rows {
-		// Show only listening ports (LISTEN)
-		if row.State != MIB_TCP_STATE_LISTEN {
-			continue
-		}
-
-		port := ntohs(row.LocalPort)
-		ports[port] = append(ports[port], ProcInfo{
-			PID:  row.OwningPid,
-			Name: processName(row.OwningPid),
-		})
-	}
-
-	return ports
-}
-
-func collectUDP() PortMap {
-	ports := make(PortMap)
-
-	var size uint32
-	procGetExtendedUdpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-
-	buf := make([]byte, size)
-	ret, _, _ := procGetExtendedUdpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 {
-		return ports
-	}
-
-	table := (*MIB_UDPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
-	rows := (*[1 << 20]MIB_UDPROW_OWNER_PID)(
-		unsafe.Pointer(&table.Table[0]),
-	)[:table.NumEntries:table.NumEntries]
-
-	for _, row := range rows {
-		port := ntohs(row.LocalPort)
-		ports[port] = append(ports[port], ProcInfo{
-			PID:  row.OwningPid,
-			Name: processName(row.OwningPid),
-		})
-	}
-
-	return ports
-}
-
-func collectAllTCPConnections() []ConnectionInfo {
-	var connections []ConnectionInfo
-
-	var size uint32
-	procGetExtendedTcpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-
-	buf := make([]byte, size)
-	ret, _, _ := procGetExtendedTcpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 {
-		return connections
-	}
-
-	table := (*MIB_TCPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
-	rows := (*[1 << 20]MIB_TCPROW_OWNER_PID)(
-		unsafe.Pointer(&table.Table[0]),
-	)[:table.NumEntries:table.NumEntries]
-
-	for _, row := range rows {
-		connections = append(connections, ConnectionInfo{
-			Protocol:    "TCP",
-			LocalAddr:   addrToString(row.LocalAddr),
-			LocalPort:   ntohs(row.LocalPort),
-			RemoteAddr:  addrToString(row.RemoteAddr),
-			RemotePort:  ntohs(row.RemotePort),
-			State:       tcpStateToString(row.State),
-			PID:         row.OwningPid,
-			ProcessName: processName(row.OwningPid),
-		})
-	}
-
-	return connections
-}
-
-func collectAllUDPConnections() []ConnectionInfo {
-	var connections []ConnectionInfo
-
-	var size uint32
-	procGetExtendedUdpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-
-	buf := make([]byte, size)
-	ret, _, _ := procGetExtendedUdpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 {
-		return connections
-	}
-
-	table := (*MIB_UDPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
-	rows := (*[1 << 20]MIB_UDPROW_OWNER_PID)(
-		unsafe.Pointer(&table.Table[0]),
-	)[:table.NumEntries:table.NumEntries]
-
-	for _, row := range rows {
-		connections = append(connections, ConnectionInfo{
-			Protocol:    "UDP",
-			LocalAddr:   addrToString(row.LocalAddr),
-			LocalPort:   ntohs(row.LocalPort),
-			RemoteAddr:  "",
-			RemotePort:  0,
-			State:       "",
-			PID:         row.OwningPid,
-			ProcessName: processName(row.OwningPid),
-		})
-	}
-
-	return connections
-}
-
-// GetAllConnections returns information about all network connections (TCP and UDP)
-func GetAllConnections() NetworkConnections {
-	var result NetworkConnections
-
-	// Collect TCP connections
-	tcpConnections := collectAllTCPConnections()
-	result.Connections = append(result.Connections, tcpConnections...)
-
-	// Collect UDP connections
-	udpConnections := collectAllUDPConnections()
-	result.Connections = append(result.Connections, udpConnections...)
-
-	return result
-}
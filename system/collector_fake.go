@@ -0,0 +1,53 @@
+package system
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeCollector returns an in-memory snapshot. It is used by tests and
+// for working on the UI without a real network stack.
+type FakeCollector struct {
+	mtx         sync.Mutex
+	connections []ConnectionInfo
+	err         error
+}
+
+func NewFakeCollector(connections []ConnectionInfo) *FakeCollector {
+	var c FakeCollector
+	c.connections = connections
+	return &c
+}
+
+func (c *FakeCollector) Name() string {
+	return "fake"
+}
+
+func (c *FakeCollector) SetConnections(connections []ConnectionInfo) {
+	c.mtx.Lock()
+	c.connections = connections
+	c.mtx.Unlock()
+}
+
+func (c *FakeCollector) SetError(err error) {
+	c.mtx.Lock()
+	c.err = err
+	c.mtx.Unlock()
+}
+
+func (c *FakeCollector) Snapshot(ctx context.Context) (NetworkConnections, error) {
+	var result NetworkConnections
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.err != nil {
+		return result, c.err
+	}
+	result.Connections = make([]ConnectionInfo, len(c.connections))
+	copy(result.Connections, c.connections)
+	return result, nil
+}
@@ -0,0 +1,43 @@
+package system
+
+import "context"
+
+// defaultCollectorName is netlink, which falls back to procfs by itself
+// and provides the byte counters that the transfer rates need
+const defaultCollectorName = "netlink"
+
+type procfsCollector struct {
+	root string
+}
+
+func init() {
+	RegisterCollector("procfs", func() Collector { return NewProcFSCollector(ProcRoot) })
+}
+
+// NewProcFSCollector reads connections from the procfs tree at root
+func NewProcFSCollector(root string) Collector {
+	var c procfsCollector
+	c.root = root
+	return &c
+}
+
+func (c *procfsCollector) Name() string {
+	return "procfs"
+}
+
+// Snapshot returns information about all TCP, UDP and UNIX sockets
+func (c *procfsCollector) Snapshot(ctx context.Context) (NetworkConnections, error) {
+	var result NetworkConnections
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	connections, err := NewProcFS(c.root).Connections()
+	if err != nil {
+		return result, err
+	}
+	result.Connections = connections
+
+	return result, nil
+}
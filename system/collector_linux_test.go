@@ -0,0 +1,71 @@
+package system
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProcFSCollector(t *testing.T) {
+	skipBigEndian(t)
+	snapshot, err := NewProcFSCollector(fixtureProc).Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		protocol   string
+		local      string
+		localPort  uint16
+		remote     string
+		remotePort uint16
+		state      string
+		pid        uint32
+	}
+	want := map[uint64]row{
+		1001: {"TCP", "127.0.0.1", 8080, "0.0.0.0", 0, "LISTEN", 100},
+		1002: {"TCP", "10.0.0.5", 50000, "192.168.1.10", 443, "ESTABLISHED", 200},
+		0:    {"TCP", "10.0.0.5", 50001, "192.168.1.10", 443, "TIME_WAIT", 0},
+		2001: {"TCP", "::", 443, "::", 0, "LISTEN", 100},
+		2002: {"TCP", "127.0.0.1", 8080, "127.0.0.1", 51000, "ESTABLISHED", 0},
+		2003: {"TCP", "fe80::1234:5678", 22, "fe80::9abc:def0", 54321, "ESTABLISHED", 200},
+		3001: {"UDP", "0.0.0.0", 53, "", 0, "", 300},
+		3002: {"UDP", "10.0.0.5", 40000, "8.8.8.8", 53, "", 0},
+		4001: {"UDP", "::1", 5353, "", 0, "", 300},
+		5001: {"UNIX", "/run/app.sock", 0, "", 0, "LISTEN", 200},
+		5002: {"UNIX", "", 0, "", 0, "ESTABLISHED", 0},
+		5003: {"UNIX", "@abstract name", 0, "", 0, "UNCONNECTED", 0},
+		5004: {"UNIX", "/run/seq path.sock", 0, "", 0, "UNCONNECTED", 0},
+	}
+
+	if len(snapshot.Connections) != len(want) {
+		t.Errorf("got %d connections, want %d (the broken line is skipped)", len(snapshot.Connections), len(want))
+	}
+	for _, conn := range snapshot.Connections {
+		expected, ok := want[conn.Inode]
+		if !ok {
+			t.Errorf("unexpected connection %+v", conn)
+			continue
+		}
+		// The link-local address may get the zone of a host interface
+		local, _ := ParseAddr(conn.LocalAddr)
+		remote, _ := ParseAddr(conn.RemoteAddr)
+		got := row{conn.Protocol, conn.LocalAddr, conn.LocalPort, conn.RemoteAddr, conn.RemotePort, conn.State, conn.PID}
+		if local.Zone() != "" {
+			got.local = local.WithZone("").String()
+			got.remote = remote.WithZone("").String()
+		}
+		if got != expected {
+			t.Errorf("socket %d = %+v, want %+v", conn.Inode, got, expected)
+		}
+	}
+}
+
+func TestDefaultCollector(t *testing.T) {
+	if name := DefaultCollector().Name(); name != "netlink" {
+		t.Errorf("default collector is %s, want netlink", name)
+	}
+	t.Setenv("LOCALPORTS_COLLECTOR", "")
+	if c, err := SelectCollector(""); err != nil || c.Name() != "netlink" {
+		t.Errorf("SelectCollector(\"\") = %v, %v", c, err)
+	}
+}
@@ -0,0 +1,383 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+	"golang.org/x/sys/unix"
+)
+
+// netlinkCollector dumps sockets with NETLINK_SOCK_DIAG (inet_diag). The
+// state filter is applied by the kernel, so a LISTEN-only snapshot does not
+// transfer every TIME_WAIT socket. When netlink is not available the /proc
+// tables are parsed instead.
+type netlinkCollector struct {
+	root     string
+	fallback Collector
+
+	mtx            sync.Mutex
+	fallbackLogged bool
+}
+
+func init() {
+	RegisterCollector("netlink", func() Collector { return NewNetlinkCollector(ProcRoot) })
+}
+
+// NewNetlinkCollector uses the procfs tree at root to resolve socket
+// owners and as the fallback source
+func NewNetlinkCollector(root string) Collector {
+	var c netlinkCollector
+	c.root = root
+	c.fallback = NewProcFSCollector(root)
+	return &c
+}
+
+func (c *netlinkCollector) Name() string {
+	return "netlink"
+}
+
+func (c *netlinkCollector) Snapshot(ctx context.Context) (NetworkConnections, error) {
+	return c.SnapshotFiltered(ctx, "all", "ALL")
+}
+
+func (c *netlinkCollector) SnapshotFiltered(ctx context.Context, filterType string, filterStatus string) (NetworkConnections, error) {
+	var result NetworkConnections
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	connections, err := c.dump(ctx, filterType, filterStatus)
+	if err != nil {
+		c.mtx.Lock()
+		if !c.fallbackLogged {
+			c.fallbackLogged = true
+			logger.Println("netlink collector unavailable, using /proc:", err)
+		}
+		c.mtx.Unlock()
+		return c.fallback.Snapshot(ctx)
+	}
+	result.Connections = connections
+	return result, nil
+}
+
+// Kernel TCP states as bits of inet_diag_req_v2.idiag_states
+const (
+	tcpStateEstablishedBit = 1 << 1
+	tcpStateListenBit      = 1 << 10
+	tcpStatesAll           = 0xFFFFFFFF
+)
+
+// tcpStateMask translates the status filter of the top panel
+func tcpStateMask(filterStatus string) uint32 {
+	switch filterStatus {
+	case "LISTEN":
+		return tcpStateListenBit
+	case "ESTABLISHED":
+		return tcpStateEstablishedBit
+	case "OTHER":
+		return tcpStatesAll &^ (tcpStateListenBit | tcpStateEstablishedBit)
+	default:
+		return tcpStatesAll
+	}
+}
+
+func (c *netlinkCollector) dump(ctx context.Context, filterType string, filterStatus string) ([]ConnectionInfo, error) {
+	type request struct {
+		family   uint8
+		protocol uint8
+		states   uint32
+	}
+
+	var requests []request
+	if filterType == "tcp" || filterType == "all" {
+		states := tcpStateMask(filterStatus)
+		requests = append(requests,
+			request{unix.AF_INET, unix.IPPROTO_TCP, states},
+			request{unix.AF_INET6, unix.IPPROTO_TCP, states})
+	}
+	// Same rules as MatchFilter: with ALL types only OTHER and ALL keep UDP
+	if filterType == "udp" || (filterType == "all" && (filterStatus == "OTHER" || filterStatus == "ALL")) {
+		requests = append(requests,
+			request{unix.AF_INET, unix.IPPROTO_UDP, tcpStatesAll},
+			request{unix.AF_INET6, unix.IPPROTO_UDP, tcpStatesAll})
+	}
+
+	var messages []inetDiagMessage
+	for _, r := range requests {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := inetDiagDump(r.family, r.protocol, r.states)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, result...)
+	}
+
+	procfs := NewProcFS(c.root)
+	owners := procfs.SocketOwners()
+	zones := make(map[uint32]string)
+
+	connections := make([]ConnectionInfo, 0, len(messages))
+	for _, m := range messages {
+		connections = append(connections, m.connectionInfo(owners, zones))
+	}
+
+	// sock_diag can't filter UNIX sockets by the states used here, they
+	// are read from /proc
+	if filterType == "unix" || filterType == "all" {
+		if unixSockets, err := procfs.UnixSockets(owners); err == nil {
+			connections = append(connections, unixSockets...)
+		}
+	}
+
+	// The netlink socket only sees the namespace of this process, other
+	// namespaces are read through /proc/<pid>/net
+	self := procfs.SelfNetNS()
+	for i := range connections {
+		connections[i].NetNS = self
+	}
+	connections = append(connections, procfs.OtherNamespaceConnections(self, owners)...)
+	return connections, nil
+}
+
+// --------------------
+// inet_diag
+// --------------------
+
+const inetDiagInfo = 2 // INET_DIAG_INFO, struct tcp_info attribute
+
+type inetDiagSockID struct {
+	SPort  [2]byte
+	DPort  [2]byte
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+type inetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       inetDiagSockID
+}
+
+type inetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      inetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+type inetDiagMessage struct {
+	protocol uint8
+	msg      inetDiagMsg
+	attrs    map[uint16][]byte
+}
+
+func inetDiagDump(family uint8, protocol uint8, states uint32) ([]inetDiagMessage, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	req := inetDiagReqV2{Family: family, Protocol: protocol, States: states}
+	if protocol == unix.IPPROTO_TCP {
+		req.Ext = 1 << (inetDiagInfo - 1)
+	}
+	var body bytes.Buffer
+	binary.Write(&body, binary.NativeEndian, req)
+
+	hdr := unix.NlMsghdr{
+		Len:   uint32(unix.SizeofNlMsghdr + body.Len()),
+		Type:  unix.SOCK_DIAG_BY_FAMILY,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_DUMP,
+		Seq:   1,
+	}
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.NativeEndian, hdr)
+	packet.Write(body.Bytes())
+
+	if err := unix.Sendto(fd, packet.Bytes(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var result []inetDiagMessage
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		messages, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			switch m.Header.Type {
+			case unix.NLMSG_DONE:
+				return result, nil
+			case unix.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					errno := -int32(binary.NativeEndian.Uint32(m.Data[:4]))
+					if errno != 0 {
+						return nil, fmt.Errorf("sock_diag: %w", syscall.Errno(errno))
+					}
+				}
+				return nil, errors.New("sock_diag: error message")
+			case unix.SOCK_DIAG_BY_FAMILY:
+				msg, err := parseInetDiagMessage(m.Data)
+				if err != nil {
+					return nil, err
+				}
+				msg.protocol = protocol
+				result = append(result, msg)
+			}
+		}
+	}
+}
+
+func parseInetDiagMessage(data []byte) (inetDiagMessage, error) {
+	var result inetDiagMessage
+	size := binary.Size(result.msg)
+	if len(data) < size {
+		return result, errors.New("sock_diag: short message")
+	}
+	if err := binary.Read(bytes.NewReader(data[:size]), binary.NativeEndian, &result.msg); err != nil {
+		return result, err
+	}
+
+	// Attributes follow the message, each is rtattr {len, type} + payload
+	result.attrs = make(map[uint16][]byte)
+	rest := data[nlmsgAlign(size):]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return result, errors.New("sock_diag: truncated attribute")
+		}
+		attrLen := int(binary.NativeEndian.Uint16(rest[0:2]))
+		attrType := binary.NativeEndian.Uint16(rest[2:4])
+		if attrLen < 4 || attrLen > len(rest) {
+			return result, errors.New("sock_diag: truncated attribute")
+		}
+		result.attrs[attrType] = rest[4:attrLen]
+		next := nlmsgAlign(attrLen)
+		if next > len(rest) {
+			break
+		}
+		rest = rest[next:]
+	}
+	return result, nil
+}
+
+func nlmsgAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+func (m inetDiagMessage) connectionInfo(owners map[uint64]uint32, zones map[uint32]string) ConnectionInfo {
+	var conn ConnectionInfo
+
+	localPort := binary.BigEndian.Uint16(m.msg.ID.SPort[:])
+	remotePort := binary.BigEndian.Uint16(m.msg.ID.DPort[:])
+
+	var localAddr, remoteAddr string
+	if m.msg.Family == unix.AF_INET {
+		localAddr = netip.AddrFrom4([4]byte(m.msg.ID.Src[:4])).String()
+		remoteAddr = netip.AddrFrom4([4]byte(m.msg.ID.Dst[:4])).String()
+	} else {
+		zone := interfaceZone(m.msg.ID.If, zones)
+		localAddr = addr6ToString(m.msg.ID.Src, zone)
+		remoteAddr = addr6ToString(m.msg.ID.Dst, zone)
+	}
+
+	conn.LocalAddr = localAddr
+	conn.LocalPort = localPort
+	if m.protocol == unix.IPPROTO_TCP {
+		conn.Protocol = "TCP"
+		conn.RemoteAddr = remoteAddr
+		conn.RemotePort = remotePort
+		conn.State = tcpStateToString(linuxTCPStateToMIB(uint32(m.msg.State)))
+	} else {
+		conn.Protocol = "UDP"
+		if remotePort != 0 {
+			conn.RemoteAddr = remoteAddr
+			conn.RemotePort = remotePort
+		}
+	}
+
+	conn.Inode = uint64(m.msg.Inode)
+	conn.Stats = m.stats()
+	conn.PID = owners[uint64(m.msg.Inode)]
+	conn.ProcessName = processName(conn.PID)
+	conn.Process = processInfo(conn.PID)
+	return conn
+}
+
+// Offsets in struct tcp_info. Older kernels send a shorter structure
+// without the byte counters.
+const (
+	tcpInfoRTT           = 68
+	tcpInfoTotalRetrans  = 100
+	tcpInfoBytesAcked    = 120
+	tcpInfoBytesReceived = 128
+)
+
+func (m inetDiagMessage) stats() *ConnectionStats {
+	var s ConnectionStats
+	s.RecvQueue = m.msg.RQueue
+	s.SendQueue = m.msg.WQueue
+	s.Retransmits = uint32(m.msg.Retrans)
+	// The send queue of a listener (TCP_LISTEN) is its backlog limit, /proc shows 0
+	if m.protocol == unix.IPPROTO_TCP && m.msg.State == 10 {
+		s.SendQueue = 0
+	}
+
+	info := m.attrs[inetDiagInfo]
+	if len(info) >= tcpInfoBytesReceived+8 {
+		s.HasTCPInfo = true
+		s.RTT = time.Duration(binary.NativeEndian.Uint32(info[tcpInfoRTT:])) * time.Microsecond
+		s.Retransmits = binary.NativeEndian.Uint32(info[tcpInfoTotalRetrans:])
+		s.BytesAcked = binary.NativeEndian.Uint64(info[tcpInfoBytesAcked:])
+		s.BytesReceived = binary.NativeEndian.Uint64(info[tcpInfoBytesReceived:])
+	}
+	return &s
+}
+
+// interfaceZone resolves the interface index of a socket to its name
+func interfaceZone(index uint32, cache map[uint32]string) string {
+	if index == 0 {
+		return ""
+	}
+	if zone, ok := cache[index]; ok {
+		return zone
+	}
+	zone := fmt.Sprint(index)
+	if iface, err := net.InterfaceByIndex(int(index)); err == nil {
+		zone = iface.Name
+	}
+	cache[index] = zone
+	return zone
+}
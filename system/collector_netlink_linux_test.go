@@ -0,0 +1,195 @@
+package system
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// diagAttr is one rtattr of a fixture message
+type diagAttr struct {
+	typ     uint16
+	payload []byte
+}
+
+// diagMessage encodes an inet_diag_msg followed by its attributes, each
+// padded to 4 bytes like the kernel does
+func diagMessage(msg inetDiagMsg, attrs ...diagAttr) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.NativeEndian, msg)
+	for _, attr := range attrs {
+		var header [4]byte
+		binary.NativeEndian.PutUint16(header[0:2], uint16(4+len(attr.payload)))
+		binary.NativeEndian.PutUint16(header[2:4], attr.typ)
+		buf.Write(header[:])
+		buf.Write(attr.payload)
+		buf.Write(make([]byte, nlmsgAlign(len(attr.payload))-len(attr.payload)))
+	}
+	return buf.Bytes()
+}
+
+// tcpInfo encodes a struct tcp_info with the fields read by stats
+func tcpInfo(rttMicros uint32, retrans uint32, acked uint64, received uint64) []byte {
+	info := make([]byte, 232)
+	binary.NativeEndian.PutUint32(info[tcpInfoRTT:], rttMicros)
+	binary.NativeEndian.PutUint32(info[tcpInfoTotalRetrans:], retrans)
+	binary.NativeEndian.PutUint64(info[tcpInfoBytesAcked:], acked)
+	binary.NativeEndian.PutUint64(info[tcpInfoBytesReceived:], received)
+	return info
+}
+
+func sockID(src string, sport uint16, dst string, dport uint16) inetDiagSockID {
+	var id inetDiagSockID
+	binary.BigEndian.PutUint16(id.SPort[:], sport)
+	binary.BigEndian.PutUint16(id.DPort[:], dport)
+	putAddr(&id.Src, src)
+	putAddr(&id.Dst, dst)
+	return id
+}
+
+// putAddr stores an address the way the kernel does, IPv4 in the first
+// 4 bytes
+func putAddr(field *[16]byte, addr string) {
+	ip := netip.MustParseAddr(addr)
+	if ip.Is4() {
+		a := ip.As4()
+		copy(field[:], a[:])
+	} else {
+		*field = ip.As16()
+	}
+}
+
+func TestParseInetDiagMessage(t *testing.T) {
+	msg := inetDiagMsg{
+		Family:  unix.AF_INET,
+		State:   1, // TCP_ESTABLISHED
+		Retrans: 1,
+		ID:      sockID("10.0.0.5", 50000, "192.168.1.10", 443),
+		RQueue:  32,
+		WQueue:  16,
+		Inode:   1002,
+	}
+	data := diagMessage(msg,
+		diagAttr{typ: 99, payload: []byte{1, 2, 3}}, // Unknown, 3 bytes padded to 4
+		diagAttr{typ: inetDiagInfo, payload: tcpInfo(1500, 7, 4096, 1<<33)},
+		diagAttr{typ: 100, payload: []byte{9}},
+	)
+
+	m, err := parseInetDiagMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.attrs) != 3 || !bytes.Equal(m.attrs[99], []byte{1, 2, 3}) || !bytes.Equal(m.attrs[100], []byte{9}) {
+		t.Errorf("attributes = %v", m.attrs)
+	}
+	m.protocol = unix.IPPROTO_TCP
+
+	conn := m.connectionInfo(map[uint64]uint32{1002: 200}, map[uint32]string{})
+	if conn.Protocol != "TCP" || conn.LocalAddr != "10.0.0.5" || conn.LocalPort != 50000 ||
+		conn.RemoteAddr != "192.168.1.10" || conn.RemotePort != 443 || conn.State != "ESTABLISHED" ||
+		conn.Inode != 1002 || conn.PID != 200 {
+		t.Errorf("connection = %+v", conn)
+	}
+	want := ConnectionStats{
+		SendQueue:     16,
+		RecvQueue:     32,
+		Retransmits:   7, // tcpi_total_retrans, not the current timeout's
+		HasTCPInfo:    true,
+		RTT:           1500 * time.Microsecond,
+		BytesAcked:    4096,
+		BytesReceived: 1 << 33,
+	}
+	if conn.Stats == nil || *conn.Stats != want {
+		t.Errorf("stats = %+v, want %+v", conn.Stats, want)
+	}
+}
+
+func TestInetDiagStatsWithoutTCPInfo(t *testing.T) {
+	// A listener: the send queue is the backlog and not shown
+	listen := inetDiagMessage{protocol: unix.IPPROTO_TCP, msg: inetDiagMsg{State: 10, Retrans: 2, RQueue: 3, WQueue: 128}}
+	// Older kernels send a tcp_info without the byte counters
+	listen.attrs = map[uint16][]byte{inetDiagInfo: make([]byte, tcpInfoBytesAcked)}
+	s := listen.stats()
+	if s.HasTCPInfo || s.SendQueue != 0 || s.RecvQueue != 3 || s.Retransmits != 2 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestInetDiagAddresses(t *testing.T) {
+	tests := []struct {
+		family   uint8
+		protocol uint8
+		id       inetDiagSockID
+		local    string
+		remote   string
+	}{
+		{unix.AF_INET, unix.IPPROTO_TCP, sockID("127.0.0.1", 8080, "127.0.0.1", 51000), "127.0.0.1", "127.0.0.1"},
+		{unix.AF_INET6, unix.IPPROTO_TCP, sockID("2001:db8::1", 443, "2001:db8::2", 52000), "2001:db8::1", "2001:db8::2"},
+		{unix.AF_INET6, unix.IPPROTO_TCP, sockID("::ffff:10.0.0.5", 8080, "::ffff:10.0.0.9", 53000), "10.0.0.5", "10.0.0.9"},
+		// An unconnected UDP socket has no remote side
+		{unix.AF_INET6, unix.IPPROTO_UDP, sockID("::", 53, "::", 0), "::", ""},
+	}
+	for _, test := range tests {
+		m := inetDiagMessage{protocol: test.protocol, msg: inetDiagMsg{Family: test.family, State: 1, ID: test.id}}
+		conn := m.connectionInfo(nil, map[uint32]string{})
+		if conn.LocalAddr != test.local || conn.RemoteAddr != test.remote {
+			t.Errorf("%v -> %s, %s, want %s, %s", test.id, conn.LocalAddr, conn.RemoteAddr, test.local, test.remote)
+		}
+	}
+
+	// Link-local addresses get the zone of the socket's interface
+	m := inetDiagMessage{protocol: unix.IPPROTO_TCP, msg: inetDiagMsg{Family: unix.AF_INET6, State: 1, ID: sockID("fe80::1", 22, "fe80::2", 54000)}}
+	m.msg.ID.If = 7
+	conn := m.connectionInfo(nil, map[uint32]string{7: "eth0"})
+	if conn.LocalAddr != "fe80::1%eth0" || conn.RemoteAddr != "fe80::2%eth0" {
+		t.Errorf("link-local: %s -> %s", conn.LocalAddr, conn.RemoteAddr)
+	}
+}
+
+func TestParseInetDiagMessageTruncated(t *testing.T) {
+	data := diagMessage(inetDiagMsg{Family: unix.AF_INET},
+		diagAttr{typ: inetDiagInfo, payload: tcpInfo(1, 2, 3, 4)})
+	size := binary.Size(inetDiagMsg{})
+
+	for _, n := range []int{0, 10, size - 1, size + 2, size + 20, len(data) - 1} {
+		if _, err := parseInetDiagMessage(data[:n]); err == nil {
+			t.Errorf("message cut at %d of %d bytes was parsed", n, len(data))
+		}
+	}
+	// Without attributes the message is complete
+	if _, err := parseInetDiagMessage(data[:size]); err != nil {
+		t.Errorf("message without attributes: %v", err)
+	}
+}
+
+func TestTCPStateMask(t *testing.T) {
+	// Kernel states: 1 TCP_ESTABLISHED, 6 TCP_TIME_WAIT, 10 TCP_LISTEN
+	tests := []struct {
+		filterStatus string
+		states       []int
+		without      []int
+	}{
+		{"LISTEN", []int{10}, []int{1, 6}},
+		{"ESTABLISHED", []int{1}, []int{10, 6}},
+		{"OTHER", []int{2, 6, 8, 11}, []int{1, 10}},
+		{"ALL", []int{1, 6, 10}, nil},
+		{"", []int{1, 6, 10}, nil},
+	}
+	for _, test := range tests {
+		mask := tcpStateMask(test.filterStatus)
+		for _, state := range test.states {
+			if mask&(1<<state) == 0 {
+				t.Errorf("mask of %q lacks state %d", test.filterStatus, state)
+			}
+		}
+		for _, state := range test.without {
+			if mask&(1<<state) != 0 {
+				t.Errorf("mask of %q has state %d", test.filterStatus, state)
+			}
+		}
+	}
+}
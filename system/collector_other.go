@@ -0,0 +1,6 @@
+//go:build !windows && !linux
+
+package system
+
+// defaultCollectorName is empty, no collector exists for this platform
+const defaultCollectorName = ""
@@ -0,0 +1,312 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	AF_INET                 = 2
+	AF_INET6                = 23
+	TCP_TABLE_OWNER_PID_ALL = 5
+	UDP_TABLE_OWNER_PID     = 1
+	MIB_TCP_STATE_LISTEN    = 2
+)
+
+// --------------------
+// WinAPI structs
+// --------------------
+
+type MIB_TCPROW_OWNER_PID struct {
+	State      uint32
+	LocalAddr  uint32
+	LocalPort  uint32
+	RemoteAddr uint32
+	RemotePort uint32
+	OwningPid  uint32
+}
+
+type MIB_TCPTABLE_OWNER_PID struct {
+	NumEntries uint32
+	Table      [1]MIB_TCPROW_OWNER_PID
+}
+
+type MIB_UDPROW_OWNER_PID struct {
+	LocalAddr uint32
+	LocalPort uint32
+	OwningPid uint32
+}
+
+type MIB_UDPTABLE_OWNER_PID struct {
+	NumEntries uint32
+	Table      [1]MIB_UDPROW_OWNER_PID
+}
+
+type MIB_TCP6ROW_OWNER_PID struct {
+	LocalAddr     [16]byte
+	LocalScopeId  uint32
+	LocalPort     uint32
+	RemoteAddr    [16]byte
+	RemoteScopeId uint32
+	RemotePort    uint32
+	State         uint32
+	OwningPid     uint32
+}
+
+type MIB_TCP6TABLE_OWNER_PID struct {
+	NumEntries uint32
+	Table      [1]MIB_TCP6ROW_OWNER_PID
+}
+
+type MIB_UDP6ROW_OWNER_PID struct {
+	LocalAddr    [16]byte
+	LocalScopeId uint32
+	LocalPort    uint32
+	OwningPid    uint32
+}
+
+type MIB_UDP6TABLE_OWNER_PID struct {
+	NumEntries uint32
+	Table      [1]MIB_UDP6ROW_OWNER_PID
+}
+
+// --------------------
+// DLL imports
+// --------------------
+
+var (
+	modiphlpapi             = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable = modiphlpapi.NewProc("GetExtendedUdpTable")
+)
+
+// --------------------
+// Helpers
+// --------------------
+
+func ntohs(port uint32) uint16 {
+	p := uint16(port & 0xFFFF)
+	return (p >> 8) | (p << 8)
+}
+
+func addrToString(addr uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d",
+		byte(addr),
+		byte(addr>>8),
+		byte(addr>>16),
+		byte(addr>>24))
+}
+
+// scopeIdToZone formats an IPv6 scope ID the way Windows tools do (fe80::1%12)
+func scopeIdToZone(scopeId uint32) string {
+	if scopeId == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(scopeId), 10)
+}
+
+// maxTableAttempts bounds the retries when the table keeps growing
+// between the size query and the copy
+const maxTableAttempts = 5
+
+// extendedTable calls GetExtendedTcpTable or GetExtendedUdpTable. Sockets
+// opened between two calls make the table larger than the size returned
+// before, so ERROR_INSUFFICIENT_BUFFER is retried with the new size.
+func extendedTable(proc *windows.LazyProc, family uint32, class uint32) ([]byte, error) {
+	var buf []byte
+	var size uint32
+	for attempt := 0; attempt < maxTableAttempts; attempt++ {
+		var ptr *byte
+		if len(buf) > 0 {
+			ptr = &buf[0]
+		}
+		ret, _, _ := proc.Call(
+			uintptr(unsafe.Pointer(ptr)),
+			uintptr(unsafe.Pointer(&size)),
+			0,
+			uintptr(family),
+			uintptr(class),
+			0,
+		)
+		switch windows.Errno(ret) {
+		case 0:
+			if len(buf) > 0 {
+				return buf, nil
+			}
+			buf = make([]byte, max(size, 4))
+			size = uint32(len(buf))
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			// Some room for the sockets opened until the next call
+			buf = make([]byte, size+size/8)
+			size = uint32(len(buf))
+		default:
+			return nil, windows.Errno(ret)
+		}
+	}
+	return nil, windows.ERROR_INSUFFICIENT_BUFFER
+}
+
+// --------------------
+// Collectors
+// --------------------
+
+func collectAllTCPConnections() ([]ConnectionInfo, error) {
+	var connections []ConnectionInfo
+
+	buf, err := extendedTable(procGetExtendedTcpTable, AF_INET, TCP_TABLE_OWNER_PID_ALL)
+	if err != nil {
+		return connections, fmt.Errorf("GetExtendedTcpTable failed: %w", err)
+	}
+
+	table := (*MIB_TCPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
+	rows := (*[1 << 20]MIB_TCPROW_OWNER_PID)(
+		unsafe.Pointer(&table.Table[0]),
+	)[:table.NumEntries:table.NumEntries]
+
+	for _, row := range rows {
+		connections = append(connections, ConnectionInfo{
+			Protocol:    "TCP",
+			LocalAddr:   addrToString(row.LocalAddr),
+			LocalPort:   ntohs(row.LocalPort),
+			RemoteAddr:  addrToString(row.RemoteAddr),
+			RemotePort:  ntohs(row.RemotePort),
+			State:       tcpStateToString(row.State),
+			PID:         row.OwningPid,
+			ProcessName: processName(row.OwningPid),
+			Process:     processInfo(row.OwningPid),
+		})
+	}
+
+	return connections, nil
+}
+
+func collectAllUDPConnections() ([]ConnectionInfo, error) {
+	var connections []ConnectionInfo
+
+	buf, err := extendedTable(procGetExtendedUdpTable, AF_INET, UDP_TABLE_OWNER_PID)
+	if err != nil {
+		return connections, fmt.Errorf("GetExtendedUdpTable failed: %w", err)
+	}
+
+	table := (*MIB_UDPTABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
+	rows := (*[1 << 20]MIB_UDPROW_OWNER_PID)(
+		unsafe.Pointer(&table.Table[0]),
+	)[:table.NumEntries:table.NumEntries]
+
+	for _, row := range rows {
+		connections = append(connections, ConnectionInfo{
+			Protocol:    "UDP",
+			LocalAddr:   addrToString(row.LocalAddr),
+			LocalPort:   ntohs(row.LocalPort),
+			RemoteAddr:  "",
+			RemotePort:  0,
+			State:       "",
+			PID:         row.OwningPid,
+			ProcessName: processName(row.OwningPid),
+			Process:     processInfo(row.OwningPid),
+		})
+	}
+
+	return connections, nil
+}
+
+func collectAllTCP6Connections() ([]ConnectionInfo, error) {
+	var connections []ConnectionInfo
+
+	buf, err := extendedTable(procGetExtendedTcpTable, AF_INET6, TCP_TABLE_OWNER_PID_ALL)
+	if err != nil {
+		return connections, fmt.Errorf("GetExtendedTcpTable (IPv6) failed: %w", err)
+	}
+
+	table := (*MIB_TCP6TABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
+	rows := (*[1 << 20]MIB_TCP6ROW_OWNER_PID)(
+		unsafe.Pointer(&table.Table[0]),
+	)[:table.NumEntries:table.NumEntries]
+
+	for _, row := range rows {
+		connections = append(connections, ConnectionInfo{
+			Protocol:    "TCP",
+			LocalAddr:   addr6ToString(row.LocalAddr, scopeIdToZone(row.LocalScopeId)),
+			LocalPort:   ntohs(row.LocalPort),
+			RemoteAddr:  addr6ToString(row.RemoteAddr, scopeIdToZone(row.RemoteScopeId)),
+			RemotePort:  ntohs(row.RemotePort),
+			State:       tcpStateToString(row.State),
+			PID:         row.OwningPid,
+			ProcessName: processName(row.OwningPid),
+			Process:     processInfo(row.OwningPid),
+		})
+	}
+
+	return connections, nil
+}
+
+func collectAllUDP6Connections() ([]ConnectionInfo, error) {
+	var connections []ConnectionInfo
+
+	buf, err := extendedTable(procGetExtendedUdpTable, AF_INET6, UDP_TABLE_OWNER_PID)
+	if err != nil {
+		return connections, fmt.Errorf("GetExtendedUdpTable (IPv6) failed: %w", err)
+	}
+
+	table := (*MIB_UDP6TABLE_OWNER_PID)(unsafe.Pointer(&buf[0]))
+	rows := (*[1 << 20]MIB_UDP6ROW_OWNER_PID)(
+		unsafe.Pointer(&table.Table[0]),
+	)[:table.NumEntries:table.NumEntries]
+
+	for _, row := range rows {
+		connections = append(connections, ConnectionInfo{
+			Protocol:    "UDP",
+			LocalAddr:   addr6ToString(row.LocalAddr, scopeIdToZone(row.LocalScopeId)),
+			LocalPort:   ntohs(row.LocalPort),
+			RemoteAddr:  "",
+			RemotePort:  0,
+			State:       "",
+			PID:         row.OwningPid,
+			ProcessName: processName(row.OwningPid),
+			Process:     processInfo(row.OwningPid),
+		})
+	}
+
+	return connections, nil
+}
+
+const defaultCollectorName = "winapi"
+
+type winAPICollector struct{}
+
+func init() {
+	RegisterCollector("winapi", func() Collector { return &winAPICollector{} })
+}
+
+func (c *winAPICollector) Name() string {
+	return "winapi"
+}
+
+// Snapshot returns information about all network connections (TCP and UDP, IPv4 and IPv6)
+func (c *winAPICollector) Snapshot(ctx context.Context) (NetworkConnections, error) {
+	var result NetworkConnections
+
+	collectors := []func() ([]ConnectionInfo, error){
+		collectAllTCPConnections,
+		collectAllTCP6Connections,
+		collectAllUDPConnections,
+		collectAllUDP6Connections,
+	}
+
+	for _, collect := range collectors {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		connections, err := collect()
+		if err != nil {
+			return result, err
+		}
+		result.Connections = append(result.Connections, connections...)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,167 @@
+package system
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ContainerInfo is what the cgroup of a process tells about where it runs
+type ContainerInfo struct {
+	Runtime string // "docker", "podman", "containerd", "cri-o" or "kubernetes"
+	ID      string // Container ID
+	PodUID  string // Kubernetes pod UID
+	Unit    string // systemd unit, e.g. "sshd.service"
+}
+
+var containerIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Container ID prefixes of systemd scopes, e.g. docker-<id>.scope
+var containerScopePrefixes = []struct {
+	prefix  string
+	runtime string
+}{
+	{"docker-", "docker"},
+	{"libpod-", "podman"},
+	{"cri-containerd-", "containerd"},
+	{"crio-", "cri-o"},
+}
+
+// parseCgroup reads the content of /proc/<pid>/cgroup. Both the cgroupfs
+// (/docker/<id>, /kubepods/<qos>/pod<uid>/<id>) and the systemd layouts
+// (docker-<id>.scope, kubepods-<qos>-pod<uid>.slice) are understood.
+func parseCgroup(content string) ContainerInfo {
+	var result ContainerInfo
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		info := parseCgroupPath(parts[2])
+		if result.ID == "" && info.ID != "" {
+			result.Runtime = info.Runtime
+			result.ID = info.ID
+		}
+		if result.PodUID == "" && info.PodUID != "" {
+			result.PodUID = info.PodUID
+		}
+		// The unified hierarchy (0::) and name=systemd carry the unit
+		if result.Unit == "" && info.Unit != "" && (parts[0] == "0" || parts[1] == "name=systemd") {
+			result.Unit = info.Unit
+		}
+	}
+	if result.PodUID != "" && result.Runtime == "" {
+		result.Runtime = "kubernetes"
+	}
+	return result
+}
+
+func parseCgroupPath(path string) ContainerInfo {
+	var result ContainerInfo
+	parent := ""
+	for _, component := range strings.Split(path, "/") {
+		name := strings.TrimSuffix(component, ".scope")
+
+		for _, p := range containerScopePrefixes {
+			if id, ok := strings.CutPrefix(name, p.prefix); ok && containerIDPattern.MatchString(id) {
+				result.Runtime = p.runtime
+				result.ID = id
+			}
+		}
+		if containerIDPattern.MatchString(name) {
+			result.ID = name
+			if parent == "docker" {
+				result.Runtime = "docker"
+			}
+		}
+
+		if uid, ok := podUID(component); ok {
+			result.PodUID = uid
+		}
+
+		if strings.HasSuffix(component, ".service") || (strings.HasSuffix(component, ".scope") && result.ID == "") {
+			result.Unit = component
+		}
+		parent = component
+	}
+	return result
+}
+
+// podUID finds the pod UID in pod<uid> or kubepods-<qos>-pod<uid>.slice,
+// where systemd writes the dashes of the UID as underscores
+func podUID(component string) (string, bool) {
+	name := strings.TrimSuffix(component, ".slice")
+	index := strings.LastIndex(name, "pod")
+	if index < 0 || (!strings.HasPrefix(name, "pod") && !strings.HasPrefix(name, "kubepods")) {
+		return "", false
+	}
+	uid := strings.ReplaceAll(name[index+3:], "_", "-")
+	if len(uid) != 36 {
+		return "", false
+	}
+	return uid, true
+}
+
+// ContainerLabel names the container or unit of the owning process for
+// the table: the container name when the Docker API knows it, otherwise
+// runtime and short ID, the pod, the socket unit of a socket held by
+// systemd or the systemd unit
+func ContainerLabel(conn ConnectionInfo) string {
+	c := conn.Process.Container
+	if c.ID != "" {
+		if name := dockerContainerName(c.ID); name != "" {
+			return name
+		}
+	}
+	if conn.Process.Name == "docker-proxy" {
+		if name := dockerContainerByPort(conn.Protocol, conn.LocalPort); name != "" {
+			return name
+		}
+	}
+	if activation, ok := SystemdSocketUnit(conn); ok {
+		return activation.Socket
+	}
+	if c.PodUID != "" {
+		return "pod:" + c.PodUID
+	}
+	if c.ID != "" {
+		return c.Runtime + ":" + shortContainerID(c.ID)
+	}
+	return c.Unit
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// MatchContainer reports whether the label, container ID, pod UID or
+// unit of the connection contains pattern, ignoring case
+func MatchContainer(conn ConnectionInfo, pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	pattern = strings.ToLower(pattern)
+	c := conn.Process.Container
+	activation, _ := SystemdSocketUnit(conn)
+	for _, value := range []string{ContainerLabel(conn), c.ID, c.PodUID, c.Unit, activation.Service} {
+		if value != "" && strings.Contains(strings.ToLower(value), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func FilterContainer(conns []ConnectionInfo, pattern string) []ConnectionInfo {
+	if pattern == "" {
+		return conns
+	}
+	result := make([]ConnectionInfo, 0)
+	for _, conn := range conns {
+		if MatchContainer(conn, pattern) {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package system
+
+import "testing"
+
+const (
+	testContainerID = "3f4e1b2c5d6a7980a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718"
+	testPodUID      = "0d1c2b3a-4f5e-6d7c-8b9a-a1b2c3d4e5f6"
+)
+
+func TestParseCgroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    ContainerInfo
+	}{
+		{"docker on cgroupfs v1", "" +
+			"12:pids:/docker/" + testContainerID + "\n" +
+			"11:memory:/docker/" + testContainerID + "\n" +
+			"1:name=systemd:/docker/" + testContainerID + "\n",
+			ContainerInfo{Runtime: "docker", ID: testContainerID}},
+		{"docker scope on v2", "0::/system.slice/docker-" + testContainerID + ".scope\n",
+			ContainerInfo{Runtime: "docker", ID: testContainerID}},
+		{"podman", "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + testContainerID + ".scope/container\n",
+			ContainerInfo{Runtime: "podman", ID: testContainerID, Unit: "user@1000.service"}},
+		{"containerd pod slice with underscores", "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" +
+			"0d1c2b3a_4f5e_6d7c_8b9a_a1b2c3d4e5f6.slice/cri-containerd-" + testContainerID + ".scope\n",
+			ContainerInfo{Runtime: "containerd", ID: testContainerID, PodUID: testPodUID}},
+		{"kubepods on cgroupfs", "4:cpu,cpuacct:/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID + "\n",
+			ContainerInfo{Runtime: "kubernetes", ID: testContainerID, PodUID: testPodUID}},
+		{"cri-o", "0::/kubepods.slice/kubepods-pod0d1c2b3a_4f5e_6d7c_8b9a_a1b2c3d4e5f6.slice/crio-" + testContainerID + ".scope\n",
+			ContainerInfo{Runtime: "cri-o", ID: testContainerID, PodUID: testPodUID}},
+		{"sshd on v1", "" +
+			"5:cpu,cpuacct:/system.slice/cron.service\n" +
+			"4:memory:/system.slice\n" +
+			"1:name=systemd:/system.slice/sshd.service\n",
+			ContainerInfo{Unit: "sshd.service"}},
+		{"sshd on v2", "0::/system.slice/sshd.service\n",
+			ContainerInfo{Unit: "sshd.service"}},
+		{"session scope", "0::/user.slice/user-1000.slice/session-3.scope\n",
+			ContainerInfo{Unit: "session-3.scope"}},
+		{"root cgroup", "0::/\n", ContainerInfo{}},
+		{"short ID is not a container", "0::/system.slice/docker-3f4e1b2c.scope\n",
+			ContainerInfo{Unit: "docker-3f4e1b2c.scope"}},
+		{"empty", "", ContainerInfo{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseCgroup(test.content); got != test.want {
+				t.Errorf("parseCgroup = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCgroupPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want ContainerInfo
+	}{
+		{"/docker/" + testContainerID, ContainerInfo{Runtime: "docker", ID: testContainerID}},
+		// Without a known parent the runtime stays unknown
+		{"/lxc/" + testContainerID, ContainerInfo{ID: testContainerID}},
+		{"/system.slice/docker-" + testContainerID + ".scope", ContainerInfo{Runtime: "docker", ID: testContainerID}},
+		{"/system.slice/nginx.service", ContainerInfo{Unit: "nginx.service"}},
+		{"", ContainerInfo{}},
+	}
+	for _, test := range tests {
+		if got := parseCgroupPath(test.path); got != test.want {
+			t.Errorf("parseCgroupPath(%q) = %+v, want %+v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestPodUID(t *testing.T) {
+	tests := []struct {
+		component string
+		uid       string
+		ok        bool
+	}{
+		{"pod" + testPodUID, testPodUID, true},
+		{"kubepods-burstable-pod0d1c2b3a_4f5e_6d7c_8b9a_a1b2c3d4e5f6.slice", testPodUID, true},
+		{"kubepods-pod0d1c2b3a_4f5e_6d7c_8b9a_a1b2c3d4e5f6.slice", testPodUID, true},
+		{"kubepods-burstable.slice", "", false},
+		{"kubepods.slice", "", false},
+		{"pod1234", "", false},
+		{"podman-" + testPodUID, "", false},
+		{"system.slice", "", false},
+	}
+	for _, test := range tests {
+		uid, ok := podUID(test.component)
+		if uid != test.uid || ok != test.ok {
+			t.Errorf("podUID(%q) = %q, %v, want %q, %v", test.component, uid, ok, test.uid, test.ok)
+		}
+	}
+}
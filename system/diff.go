@@ -0,0 +1,144 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ConnectionKey identifies a connection across snapshots
+type ConnectionKey struct {
+	Protocol   string
+	LocalAddr  string
+	LocalPort  uint16
+	RemoteAddr string
+	RemotePort uint16
+	PID        uint32
+	Inode      uint64 // Only for UNIX sockets, which often have no path
+	NetNS      uint64 // The same tuple may exist in several namespaces
+}
+
+func KeyOf(conn ConnectionInfo) ConnectionKey {
+	key := ConnectionKey{
+		Protocol:   conn.Protocol,
+		LocalAddr:  conn.LocalAddr,
+		LocalPort:  conn.LocalPort,
+		RemoteAddr: conn.RemoteAddr,
+		RemotePort: conn.RemotePort,
+		PID:        conn.PID,
+		NetNS:      conn.NetNS,
+	}
+	if conn.Protocol == "UNIX" {
+		key.Inode = conn.Inode
+	}
+	return key
+}
+
+func (k ConnectionKey) String() string {
+	if k.Protocol == "UNIX" {
+		return fmt.Sprintf("UNIX %s inode %d pid %d", k.LocalAddr, k.Inode, k.PID)
+	}
+	remote := "*"
+	if k.RemoteAddr != "" {
+		remote = FormatEndpoint(k.RemoteAddr, k.RemotePort)
+	}
+	return fmt.Sprintf("%s %s -> %s pid %d",
+		k.Protocol,
+		FormatEndpoint(k.LocalAddr, k.LocalPort),
+		remote,
+		k.PID)
+}
+
+type ChangeType string
+
+// Connection change types. They are also used as System event names.
+const (
+	ConnectionOpened         ChangeType = "connection_opened"
+	ConnectionClosed         ChangeType = "connection_closed"
+	ConnectionStateChanged   ChangeType = "connection_state_changed"
+	ConnectionProcessChanged ChangeType = "connection_process_changed"
+)
+
+// ConnectionChange describes the difference of one connection between
+// two snapshots. Old is empty for opened connections, New is empty for
+// closed ones.
+type ConnectionChange struct {
+	Type ChangeType
+	Key  ConnectionKey
+	Old  ConnectionInfo
+	New  ConnectionInfo
+}
+
+func indexSnapshot(conns []ConnectionInfo) map[ConnectionKey]ConnectionInfo {
+	result := make(map[ConnectionKey]ConnectionInfo, len(conns))
+	for _, conn := range conns {
+		result[KeyOf(conn)] = conn
+	}
+	return result
+}
+
+// DiffSnapshots returns the changes between two snapshots. Closed
+// connections come first, then opened and changed ones in the order of next.
+func DiffSnapshots(prev []ConnectionInfo, next []ConnectionInfo) []ConnectionChange {
+	return diffIndexed(indexSnapshot(prev), prev, indexSnapshot(next), next)
+}
+
+func diffIndexed(prevIndex map[ConnectionKey]ConnectionInfo, prev []ConnectionInfo, nextIndex map[ConnectionKey]ConnectionInfo, next []ConnectionInfo) []ConnectionChange {
+	var changes []ConnectionChange
+
+	reported := make(map[ConnectionKey]bool)
+	for _, conn := range prev {
+		key := KeyOf(conn)
+		if _, ok := nextIndex[key]; ok || reported[key] {
+			continue
+		}
+		reported[key] = true
+		changes = append(changes, ConnectionChange{Type: ConnectionClosed, Key: key, Old: conn})
+	}
+
+	for _, conn := range next {
+		key := KeyOf(conn)
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		old, ok := prevIndex[key]
+		if !ok {
+			changes = append(changes, ConnectionChange{Type: ConnectionOpened, Key: key, New: conn})
+			continue
+		}
+		if old.ProcessName != conn.ProcessName || !old.Process.SameProcess(conn.Process) {
+			changes = append(changes, ConnectionChange{Type: ConnectionProcessChanged, Key: key, Old: old, New: conn})
+		}
+		if old.State != conn.State {
+			changes = append(changes, ConnectionChange{Type: ConnectionStateChanged, Key: key, Old: old, New: conn})
+		}
+	}
+
+	return changes
+}
+
+// Differ remembers the last snapshot and reports changes against it.
+// Every connection of the first snapshot is reported as opened.
+type Differ struct {
+	mtx       sync.Mutex
+	prev      []ConnectionInfo
+	prevIndex map[ConnectionKey]ConnectionInfo
+}
+
+func NewDiffer() *Differ {
+	var c Differ
+	c.prevIndex = make(map[ConnectionKey]ConnectionInfo)
+	return &c
+}
+
+func (c *Differ) Update(conns []ConnectionInfo) []ConnectionChange {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	nextIndex := indexSnapshot(conns)
+	changes := diffIndexed(c.prevIndex, c.prev, nextIndex, conns)
+	c.prev = conns
+	c.prevIndex = nextIndex
+	return changes
+}
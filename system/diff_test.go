@@ -0,0 +1,115 @@
+package system
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// changeList renders changes as "type port", in their order
+func changeList(changes []ConnectionChange) []string {
+	result := make([]string, 0, len(changes))
+	for _, change := range changes {
+		port := change.Key.LocalPort
+		if change.Key.Protocol == "UNIX" {
+			port = uint16(change.Key.Inode)
+		}
+		result = append(result, fmt.Sprintf("%s %d", change.Type, port))
+	}
+	return result
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+	web := ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 80, State: "LISTEN", PID: 10, ProcessName: "nginx",
+		Process: ProcessInfo{PID: 10, Name: "nginx", StartTime: started}}
+	client := ConnectionInfo{Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: 50000, RemoteAddr: "10.0.0.9", RemotePort: 443, State: "ESTABLISHED", PID: 20, ProcessName: "curl"}
+
+	closing := client
+	closing.State = "TIME_WAIT"
+	restarted := web
+	restarted.Process.StartTime = started.Add(time.Minute) // Same PID, new process
+	renamed := web
+	renamed.ProcessName = "nginx-debug"
+	renamed.Process.Name = "nginx-debug"
+	both := closing
+	both.ProcessName = "wget"
+
+	unixA := ConnectionInfo{Protocol: "UNIX", SocketType: "STREAM", State: "ESTABLISHED", PID: 30, Inode: 7001}
+	unixB := unixA
+	unixB.Inode = 7002 // No path either, only the inode tells them apart
+
+	inHost := web
+	inContainer := web
+	inContainer.NetNS = 4026532001
+
+	tests := []struct {
+		name string
+		prev []ConnectionInfo
+		next []ConnectionInfo
+		want []string
+	}{
+		{"unchanged", []ConnectionInfo{web, client}, []ConnectionInfo{client, web}, []string{}},
+		{"opened", []ConnectionInfo{web}, []ConnectionInfo{web, client}, []string{"connection_opened 50000"}},
+		{"closed", []ConnectionInfo{web, client}, []ConnectionInfo{web}, []string{"connection_closed 50000"}},
+		{"closed before opened", []ConnectionInfo{web}, []ConnectionInfo{client}, []string{"connection_closed 80", "connection_opened 50000"}},
+		{"state changed", []ConnectionInfo{client}, []ConnectionInfo{closing}, []string{"connection_state_changed 50000"}},
+		{"process restarted", []ConnectionInfo{web}, []ConnectionInfo{restarted}, []string{"connection_process_changed 80"}},
+		{"process renamed", []ConnectionInfo{web}, []ConnectionInfo{renamed}, []string{"connection_process_changed 80"}},
+		{"process and state changed", []ConnectionInfo{client}, []ConnectionInfo{both}, []string{"connection_process_changed 50000", "connection_state_changed 50000"}},
+		{"unix sockets by inode", []ConnectionInfo{unixA}, []ConnectionInfo{unixA, unixB}, []string{"connection_opened 7002"}},
+		{"unix socket replaced", []ConnectionInfo{unixA}, []ConnectionInfo{unixB}, []string{"connection_closed 7001", "connection_opened 7002"}},
+		{"namespaces apart", []ConnectionInfo{inHost, inContainer}, []ConnectionInfo{inContainer}, []string{"connection_closed 80"}},
+		{"namespace opened", []ConnectionInfo{inHost}, []ConnectionInfo{inHost, inContainer}, []string{"connection_opened 80"}},
+		{"duplicates opened once", nil, []ConnectionInfo{client, client}, []string{"connection_opened 50000"}},
+		{"duplicates closed once", []ConnectionInfo{client, client}, nil, []string{"connection_closed 50000"}},
+		{"duplicates unchanged", []ConnectionInfo{client, client}, []ConnectionInfo{client}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := changeList(DiffSnapshots(test.prev, test.next))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("changes %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffNamespaceKey(t *testing.T) {
+	inHost := ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 80, State: "LISTEN", PID: 10}
+	inContainer := inHost
+	inContainer.NetNS = 4026532001
+
+	changes := DiffSnapshots([]ConnectionInfo{inHost, inContainer}, []ConnectionInfo{inContainer})
+	if len(changes) != 1 || changes[0].Key.NetNS != 0 || changes[0].Old.NetNS != 0 {
+		t.Errorf("changes = %+v, want the host socket closed", changes)
+	}
+}
+
+func TestDifferUpdate(t *testing.T) {
+	web := ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 80, State: "LISTEN", PID: 10, ProcessName: "nginx"}
+	client := ConnectionInfo{Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: 50000, RemoteAddr: "10.0.0.9", RemotePort: 443, State: "ESTABLISHED", PID: 20, ProcessName: "curl"}
+	closing := client
+	closing.State = "FIN_WAIT1"
+
+	differ := NewDiffer()
+	steps := []struct {
+		snapshot []ConnectionInfo
+		want     []string
+	}{
+		// Everything of the first snapshot is new
+		{[]ConnectionInfo{web}, []string{"connection_opened 80"}},
+		{[]ConnectionInfo{web}, []string{}},
+		{[]ConnectionInfo{web, client}, []string{"connection_opened 50000"}},
+		{[]ConnectionInfo{web, closing}, []string{"connection_state_changed 50000"}},
+		{[]ConnectionInfo{web}, []string{"connection_closed 50000"}},
+		{nil, []string{"connection_closed 80"}},
+	}
+	for i, step := range steps {
+		got := changeList(differ.Update(step.snapshot))
+		if !slices.Equal(got, step.want) {
+			t.Errorf("update %d: changes %v, want %v", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u00io/gomisc/logger"
+)
+
+// DefaultDockerSocket is where dockerd listens by default. Podman offers
+// the same API on /run/podman/podman.sock.
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// dockerRefreshInterval is how old the container list may get
+const dockerRefreshInterval = 10 * time.Second
+
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+	Ports []struct {
+		PublicPort uint16 `json:"PublicPort"`
+		Type       string `json:"Type"`
+	} `json:"Ports"`
+}
+
+// dockerFirstFetchTimeout bounds the wait of the first lookup
+const dockerFirstFetchTimeout = 500 * time.Millisecond
+
+// dockerNames caches the container names of the Docker API. The first
+// lookup waits briefly for the list, so one-off commands like list get the
+// names too; later ones never wait and the list is refreshed in the
+// background.
+type dockerNames struct {
+	mtx        sync.Mutex
+	socket     string
+	client     *http.Client
+	updated    time.Time
+	refreshing bool
+	names      map[string]string // container ID -> name
+	ports      map[string]string // "tcp/8080" -> name
+	logged     bool
+}
+
+var docker dockerNames
+
+// SetDockerSocket enables container names from the Docker API on the
+// given Unix socket. An empty path disables the lookups.
+func SetDockerSocket(path string) {
+	docker.mtx.Lock()
+	defer docker.mtx.Unlock()
+	docker.socket = path
+	docker.names = nil
+	docker.ports = nil
+	docker.updated = time.Time{}
+	docker.client = nil
+	if path == "" {
+		return
+	}
+	docker.client = &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func dockerContainerName(id string) string {
+	docker.mtx.Lock()
+	defer docker.mtx.Unlock()
+	docker.refreshIfStale()
+	return docker.names[id]
+}
+
+// dockerContainerByPort finds the container that publishes a host port,
+// which is what docker-proxy listens on
+func dockerContainerByPort(protocol string, port uint16) string {
+	docker.mtx.Lock()
+	defer docker.mtx.Unlock()
+	docker.refreshIfStale()
+	return docker.ports[fmt.Sprintf("%s/%d", strings.ToLower(protocol), port)]
+}
+
+func (c *dockerNames) refreshIfStale() {
+	if c.client == nil || c.refreshing || time.Since(c.updated) < dockerRefreshInterval {
+		return
+	}
+	if c.updated.IsZero() {
+		c.fetchFirst()
+		return
+	}
+	c.refreshing = true
+	go c.refresh(c.client, c.socket)
+}
+
+// fetchFirst loads the list while the lock is held. When the API is too
+// slow the list is loaded in the background instead.
+func (c *dockerNames) fetchFirst() {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerFirstFetchTimeout)
+	defer cancel()
+	names, ports, err := fetchDockerContainers(ctx, c.client)
+	c.updated = time.Now()
+	if err != nil && ctx.Err() != nil {
+		c.refreshing = true
+		go c.refresh(c.client, c.socket)
+		return
+	}
+	c.apply(names, ports, err)
+}
+
+func (c *dockerNames) refresh(client *http.Client, socket string) {
+	names, ports, err := fetchDockerContainers(context.Background(), client)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.refreshing = false
+	c.updated = time.Now()
+	if c.socket != socket {
+		return
+	}
+	c.apply(names, ports, err)
+}
+
+func (c *dockerNames) apply(names map[string]string, ports map[string]string, err error) {
+	if err != nil {
+		if !c.logged {
+			c.logged = true
+			logger.Println("docker api error:", err)
+		}
+		return
+	}
+	c.names = names
+	c.ports = ports
+}
+
+func fetchDockerContainers(ctx context.Context, client *http.Client) (map[string]string, map[string]string, error) {
+	// The host is not used for a Unix socket, but needed for the URL
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("docker api: %s", resp.Status)
+	}
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, nil, err
+	}
+
+	names := make(map[string]string)
+	ports := make(map[string]string)
+	for _, container := range containers {
+		if len(container.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(container.Names[0], "/")
+		names[container.ID] = name
+		for _, port := range container.Ports {
+			if port.PublicPort != 0 {
+				ports[fmt.Sprintf("%s/%d", port.Type, port.PublicPort)] = name
+			}
+		}
+	}
+	return names, ports, nil
+}
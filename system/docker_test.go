@@ -0,0 +1,67 @@
+package system
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveDocker answers /containers/json on a Unix socket after delay
+func serveDocker(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("no unix sockets:", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte(`[{"Id":"abc123","Names":["/web"],"Ports":[{"PublicPort":8080,"Type":"tcp"},{"PrivatePort":53,"Type":"udp"}]}]`))
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(func() {
+		server.Close()
+		SetDockerSocket("")
+	})
+	return path
+}
+
+func TestDockerFirstLookup(t *testing.T) {
+	SetDockerSocket(serveDocker(t, 0))
+
+	// The first lookup already has the names
+	if name := dockerContainerName("abc123"); name != "web" {
+		t.Errorf("container name = %q, want web", name)
+	}
+	if name := dockerContainerByPort("TCP", 8080); name != "web" {
+		t.Errorf("container of port 8080 = %q, want web", name)
+	}
+	if name := dockerContainerByPort("UDP", 53); name != "" {
+		t.Errorf("unpublished port has container %q", name)
+	}
+}
+
+func TestDockerSlowFirstLookup(t *testing.T) {
+	SetDockerSocket(serveDocker(t, 2*dockerFirstFetchTimeout))
+
+	start := time.Now()
+	if name := dockerContainerName("abc123"); name != "" {
+		t.Errorf("container name = %q before the list arrived", name)
+	}
+	if elapsed := time.Since(start); elapsed > 2*dockerFirstFetchTimeout {
+		t.Errorf("first lookup waited %v", elapsed)
+	}
+
+	// The list is loaded in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for dockerContainerName("abc123") != "web" {
+		if time.Now().After(deadline) {
+			t.Fatal("container name never arrived")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,174 @@
+package system
+
+import (
+	"cmp"
+	"sort"
+	"strings"
+)
+
+// Columns understood by SortConnections
+const (
+	ColumnType          = "type"
+	ColumnLocalPort     = "local_port"
+	ColumnLocalAddress  = "local_address"
+	ColumnRemoteAddress = "remote_address"
+	ColumnRemotePort    = "remote_port"
+	ColumnStatus        = "status"
+	ColumnPID           = "pid"
+	ColumnProgram       = "program"
+	ColumnService       = "service"
+	ColumnCountry       = "country"
+	ColumnContainer     = "container"
+	ColumnNetNS         = "netns"
+
+	ColumnRTT           = "rtt"
+	ColumnRetransmits   = "retransmits"
+	ColumnSendQueue     = "send_queue"
+	ColumnRecvQueue     = "recv_queue"
+	ColumnBytesAcked    = "bytes_acked"
+	ColumnBytesReceived = "bytes_received"
+	ColumnRateIn        = "rate_in"
+	ColumnRateOut       = "rate_out"
+)
+
+var SortColumns = []string{
+	ColumnType,
+	ColumnLocalPort,
+	ColumnLocalAddress,
+	ColumnRemoteAddress,
+	ColumnRemotePort,
+	ColumnStatus,
+	ColumnPID,
+	ColumnProgram,
+	ColumnService,
+	ColumnCountry,
+	ColumnContainer,
+	ColumnNetNS,
+	ColumnRTT,
+	ColumnRetransmits,
+	ColumnSendQueue,
+	ColumnRecvQueue,
+	ColumnBytesAcked,
+	ColumnBytesReceived,
+	ColumnRateIn,
+	ColumnRateOut,
+}
+
+// Values of the type and status filters
+var FilterTypes = []string{"tcp", "udp", "unix", "all"}
+var FilterStatuses = []string{"LISTEN", "ESTABLISHED", "OTHER", "ALL"}
+
+// MatchFilter reports whether the connection passes the type ("tcp",
+// "udp", "unix", "all") and status ("LISTEN", "ESTABLISHED", "OTHER",
+// "ALL") filters of the top panel. The status filter is ignored when only
+// UDP is shown, as UDP sockets have no state.
+func MatchFilter(conn ConnectionInfo, filterType string, filterStatus string) bool {
+	if filterType == "tcp" && conn.Protocol != "TCP" {
+		return false
+	}
+	if filterType == "udp" && conn.Protocol != "UDP" {
+		return false
+	}
+	if filterType == "unix" && conn.Protocol != "UNIX" {
+		return false
+	}
+	statusApplies := filterType == "tcp" || filterType == "unix" || filterType == "all"
+	if filterStatus == "LISTEN" && conn.State != "LISTEN" && statusApplies {
+		return false
+	}
+	if filterStatus == "ESTABLISHED" && conn.State != "ESTABLISHED" && statusApplies {
+		return false
+	}
+	if filterStatus == "OTHER" && (conn.State == "LISTEN" || conn.State == "ESTABLISHED") && statusApplies {
+		return false
+	}
+	return true
+}
+
+func FilterConnections(conns []ConnectionInfo, filterType string, filterStatus string) []ConnectionInfo {
+	result := make([]ConnectionInfo, 0)
+	for _, conn := range conns {
+		if MatchFilter(conn, filterType, filterStatus) {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
+
+// SortConnections sorts conns in place by one of the Column* keys. Ties
+// are broken by protocol, addresses, ports and PID so the order is stable
+// between snapshots.
+func SortConnections(conns []ConnectionInfo, column string, asc bool) {
+	sort.SliceStable(conns, func(i, j int) bool {
+		result := compareByColumn(conns[i], conns[j], column)
+		if result == 0 {
+			result = compareByTuple(conns[i], conns[j])
+		}
+		if asc {
+			return result < 0
+		}
+		return result > 0
+	})
+}
+
+func compareByColumn(a ConnectionInfo, b ConnectionInfo, column string) int {
+	switch column {
+	case ColumnType:
+		return strings.Compare(a.Protocol, b.Protocol)
+	case ColumnLocalPort:
+		return cmp.Compare(a.LocalPort, b.LocalPort)
+	case ColumnLocalAddress:
+		return CompareAddresses(a.LocalAddr, b.LocalAddr)
+	case ColumnRemoteAddress:
+		return CompareAddresses(a.RemoteAddr, b.RemoteAddr)
+	case ColumnRemotePort:
+		return cmp.Compare(a.RemotePort, b.RemotePort)
+	case ColumnStatus:
+		return strings.Compare(a.State, b.State)
+	case ColumnPID:
+		return cmp.Compare(a.PID, b.PID)
+	case ColumnProgram:
+		return strings.Compare(a.ProcessName, b.ProcessName)
+	case ColumnService:
+		return strings.Compare(serviceByConnection(a), serviceByConnection(b))
+	case ColumnCountry:
+		countryA, errA := GetCountryByIP(a.RemoteAddr)
+		if errA != nil {
+			countryA = ""
+		}
+		countryB, errB := GetCountryByIP(b.RemoteAddr)
+		if errB != nil {
+			countryB = ""
+		}
+		return strings.Compare(countryA, countryB)
+	case ColumnContainer:
+		return strings.Compare(ContainerLabel(a), ContainerLabel(b))
+	case ColumnNetNS:
+		return strings.Compare(NetNSLabel(a), NetNSLabel(b))
+	case ColumnRTT, ColumnRetransmits, ColumnSendQueue, ColumnRecvQueue, ColumnBytesAcked, ColumnBytesReceived:
+		return compareStats(a, b, column)
+	case ColumnRateIn, ColumnRateOut:
+		return compareRates(a, b, column)
+	default:
+		return 0
+	}
+}
+
+func compareByTuple(a ConnectionInfo, b ConnectionInfo) int {
+	if result := strings.Compare(a.Protocol, b.Protocol); result != 0 {
+		return result
+	}
+	if result := CompareAddresses(a.LocalAddr, b.LocalAddr); result != 0 {
+		return result
+	}
+	if result := cmp.Compare(a.LocalPort, b.LocalPort); result != 0 {
+		return result
+	}
+	if result := CompareAddresses(a.RemoteAddr, b.RemoteAddr); result != 0 {
+		return result
+	}
+	if result := cmp.Compare(a.RemotePort, b.RemotePort); result != 0 {
+		return result
+	}
+	return cmp.Compare(a.PID, b.PID)
+}
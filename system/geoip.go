@@ -34,8 +34,11 @@ func GetCountryByIP(ipStr string) (string, error) {
 			Names   map[string]string `maxminddb:"names"`
 		} `maxminddb:"country"`
 	}
-	ip := net.ParseIP(ipStr)
-	err := geoip.db.Lookup(ip, &result)
+	ip, ok := ParseAddr(ipStr)
+	if !ok {
+		return "", nil
+	}
+	err := geoip.db.Lookup(net.IP(ip.WithZone("").AsSlice()), &result)
 	if err != nil {
 		return "", err
 	}
@@ -73,8 +76,11 @@ func GetCountryISOCodeByIP(ipStr string) (string, error) {
 			Names   map[string]string `maxminddb:"names"`
 		} `maxminddb:"country"`
 	}
-	ip := net.ParseIP(ipStr)
-	err := geoip.db.Lookup(ip, &result)
+	ip, ok := ParseAddr(ipStr)
+	if !ok {
+		return "", nil
+	}
+	err := geoip.db.Lookup(net.IP(ip.WithZone("").AsSlice()), &result)
 	if err != nil {
 		return "", err
 	}
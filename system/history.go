@@ -0,0 +1,455 @@
+package system
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u00io/localports/localstorage"
+)
+
+// History keeps connection lifetimes in an append-only log of JSON lines,
+// one file per day. A line is written with a single write, so a crash can
+// only damage the last line of a file, and such lines are skipped on read.
+
+const (
+	historyFilePrefix = "history-"
+	historyFileSuffix = ".jsonl"
+	historyAliveEvery = time.Minute
+)
+
+// HistoryDir is where the application keeps its history
+func HistoryDir() string {
+	return filepath.Join(localstorage.Path(), "history")
+}
+
+type HistoryRetention struct {
+	MaxAge   time.Duration
+	MaxBytes int64
+}
+
+var DefaultHistoryRetention = HistoryRetention{
+	MaxAge:   30 * 24 * time.Hour,
+	MaxBytes: 100 * 1024 * 1024,
+}
+
+// ConnectionLifetime is a connection from the first to the last time it was seen
+type ConnectionLifetime struct {
+	Protocol      string    `json:"protocol"`
+	LocalAddress  string    `json:"local_address"`
+	LocalPort     uint16    `json:"local_port"`
+	RemoteAddress string    `json:"remote_address"`
+	RemotePort    uint16    `json:"remote_port"`
+	State         string    `json:"state"`
+	PID           uint32    `json:"pid"`
+	Program       string    `json:"program"`
+	Country       string    `json:"country"`
+	NetNS         uint64    `json:"netns_inode,omitempty"` // Network namespace inode (Linux)
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	Open          bool      `json:"open"`
+}
+
+// historyEntry is one line of the log
+type historyEntry struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // session, alive, open, state, process, close
+	Session int64     `json:"session"`
+
+	Protocol   string `json:"protocol,omitempty"`
+	LocalAddr  string `json:"local_address,omitempty"`
+	LocalPort  uint16 `json:"local_port,omitempty"`
+	RemoteAddr string `json:"remote_address,omitempty"`
+	RemotePort uint16 `json:"remote_port,omitempty"`
+	PID        uint32 `json:"pid,omitempty"`
+	State      string `json:"state,omitempty"`
+	Program    string `json:"program,omitempty"`
+	Country    string `json:"country,omitempty"`
+	NetNS      uint64 `json:"netns,omitempty"`
+}
+
+type History struct {
+	mtx sync.Mutex
+
+	dir       string
+	retention HistoryRetention
+	session   int64
+
+	file      *os.File
+	fileDay   string
+	lastAlive time.Time
+}
+
+func OpenHistory(dir string, retention HistoryRetention) (*History, error) {
+	var c History
+	c.dir = dir
+	c.retention = retention
+	c.session = time.Now().UnixNano()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c.prune(time.Now())
+	if err := c.write(historyEntry{Time: time.Now(), Type: "session"}); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *History) Close() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// Record appends the changes of one snapshot
+func (c *History) Record(changes []ConnectionChange, now time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, change := range changes {
+		// The history covers network connections only
+		if change.Key.Protocol == "UNIX" {
+			continue
+		}
+		entry := historyEntry{
+			Time:       now,
+			Protocol:   change.Key.Protocol,
+			LocalAddr:  change.Key.LocalAddr,
+			LocalPort:  change.Key.LocalPort,
+			RemoteAddr: change.Key.RemoteAddr,
+			RemotePort: change.Key.RemotePort,
+			PID:        change.Key.PID,
+			NetNS:      change.Key.NetNS,
+		}
+		switch change.Type {
+		case ConnectionOpened:
+			entry.Type = "open"
+			entry.State = change.New.State
+			entry.Program = change.New.ProcessName
+			entry.Country, _ = GetCountryByIP(change.New.RemoteAddr)
+		case ConnectionStateChanged:
+			entry.Type = "state"
+			entry.State = change.New.State
+		case ConnectionProcessChanged:
+			entry.Type = "process"
+			entry.Program = change.New.ProcessName
+		case ConnectionClosed:
+			entry.Type = "close"
+		default:
+			continue
+		}
+		if err := c.write(entry); err != nil {
+			return err
+		}
+	}
+
+	if now.Sub(c.lastAlive) >= historyAliveEvery {
+		return c.write(historyEntry{Time: now, Type: "alive"})
+	}
+	return nil
+}
+
+func (c *History) write(entry historyEntry) error {
+	entry.Session = c.session
+	day := entry.Time.Format("20060102")
+	if c.file == nil || day != c.fileDay {
+		if err := c.openFile(day); err != nil {
+			return err
+		}
+		c.prune(entry.Time)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := c.file.Write(line); err != nil {
+		return err
+	}
+	c.lastAlive = entry.Time
+	return nil
+}
+
+func (c *History) openFile(day string) error {
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+
+	fileName := filepath.Join(c.dir, historyFilePrefix+day+historyFileSuffix)
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Terminate a line torn by a crash, so it does not swallow the next one
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, st.Size()-1); err == nil && last[0] != '\n' {
+			f.Write([]byte{'\n'})
+		}
+	}
+
+	c.file = f
+	c.fileDay = day
+	return nil
+}
+
+// historyFiles returns the log files, oldest first
+func historyFiles(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]os.FileInfo, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, historyFilePrefix) || !strings.HasSuffix(name, historyFileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// prune removes files older than MaxAge and the oldest files above MaxBytes.
+// The file being written is never removed.
+func (c *History) prune(now time.Time) {
+	files, err := historyFiles(c.dir)
+	if err != nil {
+		return
+	}
+
+	current := historyFilePrefix + c.fileDay + historyFileSuffix
+	oldest := historyFilePrefix + now.Add(-c.retention.MaxAge).Format("20060102") + historyFileSuffix
+
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+	for _, f := range files {
+		if f.Name() == current {
+			continue
+		}
+		tooOld := c.retention.MaxAge > 0 && f.Name() < oldest
+		tooBig := c.retention.MaxBytes > 0 && total > c.retention.MaxBytes
+		if !tooOld && !tooBig {
+			continue
+		}
+		if os.Remove(filepath.Join(c.dir, f.Name())) == nil {
+			total -= f.Size()
+		}
+	}
+}
+
+// HistoryQuery selects lifetimes. Zero fields match everything.
+type HistoryQuery struct {
+	From    time.Time
+	To      time.Time
+	Port    uint16 // local or remote port
+	Process string // substring of the program name, case insensitive
+	Remote  string // remote address or CIDR prefix
+}
+
+func (q HistoryQuery) match(l ConnectionLifetime, remotePrefix netip.Prefix) bool {
+	if !q.From.IsZero() && l.LastSeen.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && l.FirstSeen.After(q.To) {
+		return false
+	}
+	if q.Port != 0 && l.LocalPort != q.Port && l.RemotePort != q.Port {
+		return false
+	}
+	if q.Process != "" && !strings.Contains(strings.ToLower(l.Program), strings.ToLower(q.Process)) {
+		return false
+	}
+	if q.Remote != "" {
+		ip, ok := ParseAddr(l.RemoteAddress)
+		if !ok || !remotePrefix.Contains(ip.WithZone("")) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRemoteFilter(s string) (netip.Prefix, error) {
+	if s == "" {
+		return netip.Prefix{}, nil
+	}
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid remote prefix: %s", s)
+		}
+		return prefix.Masked(), nil
+	}
+	ip, ok := ParseAddr(s)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("invalid remote address: %s", s)
+	}
+	ip = ip.WithZone("")
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// QueryHistory reads the log in dir and returns the matching lifetimes
+// ordered by first seen. Connections of the current session that are
+// still open have LastSeen set to now.
+func QueryHistory(dir string, q HistoryQuery) ([]ConnectionLifetime, error) {
+	remotePrefix, err := parseRemoteFilter(q.Remote)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := historyFiles(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []ConnectionLifetime{}, nil
+		}
+		return nil, err
+	}
+
+	type lifetimeKey struct {
+		session int64
+		key     ConnectionKey
+	}
+	open := make(map[lifetimeKey]*ConnectionLifetime)
+	sessionLastSeen := make(map[int64]time.Time)
+	var all []*ConnectionLifetime
+
+	for _, f := range files {
+		err := readHistoryFile(filepath.Join(dir, f.Name()), func(entry historyEntry) {
+			if entry.Time.After(sessionLastSeen[entry.Session]) {
+				sessionLastSeen[entry.Session] = entry.Time
+			}
+			lk := lifetimeKey{entry.Session, ConnectionKey{
+				Protocol:   entry.Protocol,
+				LocalAddr:  entry.LocalAddr,
+				LocalPort:  entry.LocalPort,
+				RemoteAddr: entry.RemoteAddr,
+				RemotePort: entry.RemotePort,
+				PID:        entry.PID,
+				NetNS:      entry.NetNS,
+			}}
+			switch entry.Type {
+			case "open":
+				l := &ConnectionLifetime{
+					Protocol:      entry.Protocol,
+					LocalAddress:  entry.LocalAddr,
+					LocalPort:     entry.LocalPort,
+					RemoteAddress: entry.RemoteAddr,
+					RemotePort:    entry.RemotePort,
+					State:         entry.State,
+					PID:           entry.PID,
+					Program:       entry.Program,
+					Country:       entry.Country,
+					NetNS:         entry.NetNS,
+					FirstSeen:     entry.Time,
+					LastSeen:      entry.Time,
+					Open:          true,
+				}
+				open[lk] = l
+				all = append(all, l)
+			case "state", "process", "close":
+				l, ok := open[lk]
+				if !ok {
+					return
+				}
+				l.LastSeen = entry.Time
+				if entry.Type == "state" {
+					l.State = entry.State
+				}
+				if entry.Type == "process" {
+					l.Program = entry.Program
+				}
+				if entry.Type == "close" {
+					l.Open = false
+					delete(open, lk)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Connections without a close line were open when their session ended
+	// (or crashed), or are still open in the running session
+	now := time.Now()
+	var currentSession int64
+	for session, lastSeen := range sessionLastSeen {
+		if session > currentSession && now.Sub(lastSeen) < 2*historyAliveEvery {
+			currentSession = session
+		}
+	}
+	for lk, l := range open {
+		if lk.session == currentSession {
+			l.LastSeen = now
+		} else {
+			l.LastSeen = sessionLastSeen[lk.session]
+			l.Open = false
+		}
+	}
+
+	result := make([]ConnectionLifetime, 0)
+	for _, l := range all {
+		if q.match(*l, remotePrefix) {
+			result = append(result, *l)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].FirstSeen.Before(result[j].FirstSeen)
+	})
+	return result, nil
+}
+
+func readHistoryFile(fileName string, onEntry func(entry historyEntry)) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry historyEntry
+			if json.Unmarshal(line, &entry) == nil {
+				onEntry(entry)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
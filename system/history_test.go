@@ -0,0 +1,224 @@
+package system
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryKeepsNamespacesApart(t *testing.T) {
+	dir := t.TempDir()
+	history, err := OpenHistory(dir, DefaultHistoryRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	// The same tuple in two containers, only the first one closes
+	conn := ConnectionInfo{Protocol: "TCP", LocalAddr: "172.17.0.2", LocalPort: 80, RemoteAddr: "172.17.0.1", RemotePort: 40000, State: "ESTABLISHED", PID: 10, ProcessName: "nginx"}
+	first, second := conn, conn
+	first.NetNS = 4026532001
+	second.NetNS = 4026532002
+
+	start := time.Now().Add(-time.Minute)
+	if err := history.Record(DiffSnapshots(nil, []ConnectionInfo{first, second}), start); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Record(DiffSnapshots([]ConnectionInfo{first, second}, []ConnectionInfo{second}), start.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	lifetimes, err := QueryHistory(dir, HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lifetimes) != 2 {
+		t.Fatalf("got %d lifetimes, want 2: %+v", len(lifetimes), lifetimes)
+	}
+	for _, l := range lifetimes {
+		wantOpen := l.NetNS == second.NetNS
+		if l.Open != wantOpen {
+			t.Errorf("lifetime in namespace %d: open = %v, want %v", l.NetNS, l.Open, wantOpen)
+		}
+	}
+}
+
+// writeHistoryFile writes a day file of the log from entries
+func writeHistoryFile(t *testing.T, dir string, day string, entries ...historyEntry) {
+	t.Helper()
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, historyFilePrefix+day+historyFileSuffix), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryRepairsTornLine(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	fileName := filepath.Join(dir, historyFilePrefix+now.Format("20060102")+historyFileSuffix)
+	// The last write of a crashed session stopped in the middle of a line
+	torn := `{"time":"` + now.Add(-time.Hour).Format(time.RFC3339) + `","type":"open","session":1,"protocol":"TCP","local_port":8`
+	if err := os.WriteFile(fileName, []byte(torn), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := OpenHistory(dir, DefaultHistoryRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := ConnectionInfo{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 8080, RemoteAddr: "127.0.0.1", RemotePort: 50000, State: "ESTABLISHED", PID: 10, ProcessName: "curl"}
+	if err := history.Record(DiffSnapshots(nil, []ConnectionInfo{conn}), now); err != nil {
+		t.Fatal(err)
+	}
+	history.Close()
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), torn+"\n") {
+		t.Errorf("torn line was not terminated:\n%s", data)
+	}
+	lifetimes, err := QueryHistory(dir, HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lifetimes) != 1 || lifetimes[0].LocalPort != 8080 || !lifetimes[0].Open {
+		t.Errorf("lifetimes = %+v, want the connection recorded after the torn line", lifetimes)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	now := time.Now()
+	day := func(daysAgo int) string {
+		return now.AddDate(0, 0, -daysAgo).Format("20060102")
+	}
+	// Lines of a little over 1000 bytes, today's file stays far below
+	entry := historyEntry{Time: now, Type: "process", Session: 1, Program: strings.Repeat("x", 1000)}
+
+	tests := []struct {
+		name      string
+		retention HistoryRetention
+		days      []int // Files written before opening, days ago
+		kept      []int
+	}{
+		{"by age", HistoryRetention{MaxAge: 7 * 24 * time.Hour}, []int{40, 8, 6, 1}, []int{6, 1}},
+		{"by size", HistoryRetention{MaxBytes: 2500}, []int{4, 3, 2, 1}, []int{2, 1}},
+		{"unlimited", HistoryRetention{}, []int{400, 1}, []int{400, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, d := range test.days {
+				writeHistoryFile(t, dir, day(d), entry)
+			}
+			history, err := OpenHistory(dir, test.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history.Close()
+
+			files, err := historyFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Today's file is being written and always kept
+			want := make([]string, 0)
+			for _, d := range test.kept {
+				want = append(want, historyFilePrefix+day(d)+historyFileSuffix)
+			}
+			want = append(want, historyFilePrefix+day(0)+historyFileSuffix)
+			got := make([]string, 0)
+			for _, f := range files {
+				got = append(got, f.Name())
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 3, 1, 3, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+	open := func(minutes int, localPort uint16, remote string, remotePort uint16, program string) historyEntry {
+		return historyEntry{Time: at(minutes), Type: "open", Session: 1, Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: localPort,
+			RemoteAddr: remote, RemotePort: remotePort, State: "ESTABLISHED", PID: 100, Program: program}
+	}
+	closed := func(e historyEntry, minutes int) historyEntry {
+		e.Type = "close"
+		e.Time = at(minutes)
+		e.State = ""
+		e.Program = ""
+		return e
+	}
+	psql := open(0, 50000, "10.1.2.3", 5432, "psql")
+	curl := open(30, 50001, "93.184.216.34", 443, "curl")
+	backup := open(70, 50002, "2001:db8::7", 5432, "pg_dump")
+	writeHistoryFile(t, dir, base.Format("20060102"),
+		historyEntry{Time: at(0), Type: "session", Session: 1},
+		psql, curl, closed(psql, 20), closed(curl, 40),
+		backup, closed(backup, 90),
+	)
+
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		ports []uint16
+	}{
+		{"all", HistoryQuery{}, []uint16{50000, 50001, 50002}},
+		{"from", HistoryQuery{From: at(25)}, []uint16{50001, 50002}},
+		{"to", HistoryQuery{To: at(60)}, []uint16{50000, 50001}},
+		{"alive in the range", HistoryQuery{From: at(35), To: at(75)}, []uint16{50001, 50002}},
+		{"remote port", HistoryQuery{Port: 5432}, []uint16{50000, 50002}},
+		{"local port", HistoryQuery{Port: 50001}, []uint16{50001}},
+		{"process", HistoryQuery{Process: "PG_"}, []uint16{50002}},
+		{"remote address", HistoryQuery{Remote: "10.1.2.3"}, []uint16{50000}},
+		{"remote prefix", HistoryQuery{Remote: "10.0.0.0/8"}, []uint16{50000}},
+		{"remote IPv6 prefix", HistoryQuery{Remote: "2001:db8::/32"}, []uint16{50002}},
+		{"combined", HistoryQuery{Port: 5432, From: at(60)}, []uint16{50002}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lifetimes, err := QueryHistory(dir, test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ports := make([]uint16, 0)
+			for _, l := range lifetimes {
+				ports = append(ports, l.LocalPort)
+			}
+			if !slices.Equal(ports, test.ports) {
+				t.Errorf("ports = %v, want %v", ports, test.ports)
+			}
+		})
+	}
+
+	lifetimes, err := QueryHistory(dir, HistoryQuery{Port: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := lifetimes[0]; !l.FirstSeen.Equal(at(0)) || !l.LastSeen.Equal(at(20)) || l.Open || l.Program != "psql" {
+		t.Errorf("lifetime = %+v", l)
+	}
+
+	if _, err := QueryHistory(dir, HistoryQuery{Remote: "10.0.0.0/33"}); err == nil {
+		t.Error("invalid prefix was accepted")
+	}
+}
@@ -0,0 +1,114 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultKillTimeout is how long TERM gets before KILL follows
+const DefaultKillTimeout = 5 * time.Second
+
+// ErrKillRefused is returned for processes that must not be signalled
+var ErrKillRefused = errors.New("refusing to signal")
+
+// ErrKillPermission is returned when the process belongs to another user
+var ErrKillPermission = errors.New("permission denied")
+
+// ErrProcessGone is returned when the process exited before it was
+// signalled, or its PID now belongs to another process
+var ErrProcessGone = errors.New("process is gone")
+
+// KillResult tells what happened to a signalled process
+type KillResult struct {
+	Signal    string // Last signal sent
+	Escalated bool   // KILL followed because TERM was ignored
+	Exited    bool   // The process is gone
+}
+
+// ParseSignal normalizes a signal name: "term", "SIGTERM" and "TERM" are
+// the same. Only the names of KillSignals are accepted.
+func ParseSignal(name string) (string, error) {
+	signal := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if _, ok := killSignals[signal]; !ok {
+		return "", fmt.Errorf("unknown signal: %s", name)
+	}
+	return signal, nil
+}
+
+// CheckKillable refuses PID 0 and 1, kernel and system processes and
+// this process itself
+func CheckKillable(p ProcessInfo) error {
+	if p.PID == 0 || p.PID == 1 {
+		return fmt.Errorf("%w PID %d", ErrKillRefused, p.PID)
+	}
+	if p.PID == uint32(os.Getpid()) {
+		return fmt.Errorf("%w localports itself", ErrKillRefused)
+	}
+	if isSystemProcess(p) {
+		return fmt.Errorf("%w system process %s (PID %d)", ErrKillRefused, p.Name, p.PID)
+	}
+	return nil
+}
+
+// KillProcess sends signal to the process after CheckKillable. TERM is
+// followed by KILL when the process is still running after timeout; a
+// timeout of 0 sends TERM only. Processes that were replaced by another
+// one with the same PID are not touched.
+func KillProcess(p ProcessInfo, signal string, timeout time.Duration) (KillResult, error) {
+	result := KillResult{Signal: signal}
+	if err := CheckKillable(p); err != nil {
+		return result, err
+	}
+	if !stillRunning(p) {
+		return result, fmt.Errorf("%w: %s (PID %d) exited or its PID was reused", ErrProcessGone, p.Name, p.PID)
+	}
+
+	if err := sendSignal(p.PID, signal); err != nil {
+		return result, signalError(p, signal, err)
+	}
+	if signal != "TERM" || timeout <= 0 {
+		result.Exited = waitExit(p.PID, 500*time.Millisecond)
+		return result, nil
+	}
+
+	if waitExit(p.PID, timeout) {
+		result.Exited = true
+		return result, nil
+	}
+	if !stillRunning(p) {
+		result.Exited = true
+		return result, nil
+	}
+
+	result.Signal = "KILL"
+	result.Escalated = true
+	if err := sendSignal(p.PID, "KILL"); err != nil {
+		return result, signalError(p, "KILL", err)
+	}
+	result.Exited = waitExit(p.PID, 2*time.Second)
+	return result, nil
+}
+
+func signalError(p ProcessInfo, signal string, err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: can not send %s to %s (PID %d), run as root or as the owner of the process", ErrKillPermission, signal, p.Name, p.PID)
+	}
+	return fmt.Errorf("send %s to %s (PID %d): %w", signal, p.Name, p.PID, err)
+}
+
+// waitExit polls until the process is gone or timeout expires
+func waitExit(pid uint32, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !processAlive(pid) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,59 @@
+package system
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startSleep runs a child process that is reaped when it exits
+func startSleep(t *testing.T) ProcessInfo {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip("can not start sleep:", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-done
+	})
+	pid := uint32(cmd.Process.Pid)
+	for i := 0; i < 50; i++ {
+		// comm changes from the test binary to sleep at exec
+		p, err := NewProcFS(ProcRoot).Process(pid)
+		if err == nil && p.Name == "sleep" {
+			return p
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("process %d not found", pid)
+	return ProcessInfo{}
+}
+
+func TestKillProcessReusedPID(t *testing.T) {
+	p := startSleep(t)
+
+	// The PID of an older process with the same name
+	reused := p
+	reused.StartTime = p.StartTime.Add(-time.Hour)
+	if _, err := KillProcess(reused, "TERM", 0); !errors.Is(err, ErrProcessGone) {
+		t.Fatalf("KillProcess of a reused PID: %v, want %v", err, ErrProcessGone)
+	}
+	if !processAlive(p.PID) {
+		t.Fatal("the new process was signalled")
+	}
+
+	result, err := KillProcess(p, "TERM", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Exited {
+		t.Errorf("result = %+v, want exited", result)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package system
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+var killSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// KillSignals lists the signals understood by KillProcess
+var KillSignals = []string{"TERM", "KILL", "INT", "HUP", "QUIT", "USR1", "USR2"}
+
+func sendSignal(pid uint32, signal string) error {
+	return syscall.Kill(int(pid), killSignals[signal])
+}
+
+// processAlive treats zombies as gone, they only wait for their parent
+func processAlive(pid uint32) bool {
+	err := syscall.Kill(int(pid), 0)
+	if err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join(ProcRoot, strconv.FormatUint(uint64(pid), 10), "stat"))
+	if err != nil {
+		return true
+	}
+	// The state follows the command, which is in parentheses
+	end := bytes.LastIndexByte(stat, ')')
+	return end < 0 || end+2 >= len(stat) || stat[end+2] != 'Z'
+}
+
+// stillRunning reports whether the PID still belongs to the process and
+// not to a new one that reused it
+func stillRunning(p ProcessInfo) bool {
+	current, err := NewProcFS(ProcRoot).Process(p.PID)
+	if err != nil {
+		return processAlive(p.PID)
+	}
+	return current.SameProcess(p)
+}
+
+// isSystemProcess recognizes kernel threads: kthreadd (PID 2) and its
+// children
+func isSystemProcess(p ProcessInfo) bool {
+	return p.PID == 2 || p.ParentPID == 2
+}
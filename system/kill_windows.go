@@ -0,0 +1,58 @@
+package system
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows has no signals, both end the process with TerminateProcess
+var killSignals = map[string]bool{
+	"TERM": true,
+	"KILL": true,
+}
+
+// KillSignals lists the signals understood by KillProcess
+var KillSignals = []string{"TERM", "KILL"}
+
+func sendSignal(pid uint32, signal string) error {
+	h, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.TerminateProcess(h, 1)
+}
+
+func processAlive(pid uint32) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if windows.GetExitCodeProcess(h, &code) != nil {
+		return true
+	}
+	return code == 259 // STILL_ACTIVE
+}
+
+func stillRunning(p ProcessInfo) bool {
+	if !processAlive(p.PID) {
+		return false
+	}
+	start := processStartTime(p.PID)
+	return p.StartTime.IsZero() || start.IsZero() || start.Equal(p.StartTime)
+}
+
+// isSystemProcess recognizes the System and kernel processes
+func isSystemProcess(p ProcessInfo) bool {
+	if p.PID == 4 {
+		return true
+	}
+	switch strings.ToLower(p.Name) {
+	case "system", "registry", "smss.exe", "csrss.exe", "wininit.exe", "winlogon.exe", "services.exe", "lsass.exe":
+		return true
+	}
+	return false
+}
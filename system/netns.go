@@ -0,0 +1,76 @@
+package system
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Values of the namespace filter. Any other value selects one namespace
+// by its label or inode.
+const (
+	NamespaceAll   = "all"
+	NamespaceHost  = "host"
+	NamespaceOther = "other"
+)
+
+var hostNetNSOnce sync.Once
+var hostNetNS uint64
+
+// HostNetNS returns the network namespace of init, 0 where namespaces are
+// not known
+func HostNetNS() uint64 {
+	hostNetNSOnce.Do(func() {
+		hostNetNS = NewProcFS(ProcRoot).HostNetNS()
+	})
+	return hostNetNS
+}
+
+// IsHostNetNS reports whether the connection belongs to the host
+// namespace. Connections of collectors without namespaces count as host.
+func IsHostNetNS(conn ConnectionInfo) bool {
+	return conn.NetNS == 0 || conn.NetNS == HostNetNS()
+}
+
+// NetNSLabel names the namespace of the connection: "host", the name
+// given with "ip netns add" or net:[inode]
+func NetNSLabel(conn ConnectionInfo) string {
+	if IsHostNetNS(conn) {
+		return NamespaceHost
+	}
+	if name := netNSName(conn.NetNS); name != "" {
+		return name
+	}
+	return fmt.Sprintf("net:[%d]", conn.NetNS)
+}
+
+// MatchNamespace reports whether the connection passes the namespace
+// filter: "all", "host", "other" (everything but the host), a label of
+// NetNSLabel or a namespace inode
+func MatchNamespace(conn ConnectionInfo, filter string) bool {
+	switch filter {
+	case "", NamespaceAll:
+		return true
+	case NamespaceHost:
+		return IsHostNetNS(conn)
+	case NamespaceOther:
+		return !IsHostNetNS(conn)
+	}
+	if inode, err := strconv.ParseUint(filter, 10, 64); err == nil {
+		return conn.NetNS == inode
+	}
+	return NetNSLabel(conn) == filter
+}
+
+func FilterNamespace(conns []ConnectionInfo, filter string) []ConnectionInfo {
+	if filter == "" || filter == NamespaceAll {
+		return conns
+	}
+	result := make([]ConnectionInfo, 0)
+	for _, conn := range conns {
+		if MatchNamespace(conn, filter) {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
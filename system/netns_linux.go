@@ -0,0 +1,35 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// NetNSRunDir holds the namespaces named with "ip netns add"
+var NetNSRunDir = "/run/netns"
+
+var netNSNamesMtx sync.Mutex
+var netNSNames map[uint64]string
+
+// netNSName returns the "ip netns" name of a namespace. The names are
+// read once, namespaces added later are shown by inode.
+func netNSName(inode uint64) string {
+	netNSNamesMtx.Lock()
+	defer netNSNamesMtx.Unlock()
+	if netNSNames == nil {
+		netNSNames = make(map[uint64]string)
+		entries, _ := os.ReadDir(NetNSRunDir)
+		for _, entry := range entries {
+			info, err := os.Stat(filepath.Join(NetNSRunDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				netNSNames[uint64(st.Ino)] = entry.Name()
+			}
+		}
+	}
+	return netNSNames[inode]
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package system
+
+// netNSName returns the "ip netns" name of a namespace, which only
+// exists on Linux
+func netNSName(inode uint64) string {
+	return ""
+}
@@ -0,0 +1,197 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/u00io/localports/localstorage"
+)
+
+// presetsFileName is the document in the local storage
+const presetsFileName = "presets.json"
+
+// PresetsVersion is the schema version written by this build. Older
+// documents are migrated on load.
+const PresetsVersion = 1
+
+// FilterPreset is a named set of filters and view settings of the table
+type FilterPreset struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Status     string   `json:"status"`
+	Namespace  string   `json:"namespace"`
+	Query      string   `json:"query"`
+	SortColumn string   `json:"sort_column"`
+	SortAsc    bool     `json:"sort_asc"`
+	Columns    []string `json:"columns"` // Visible columns, all defaults when empty
+}
+
+// DefaultFilterPreset is what the window shows without a saved default
+func DefaultFilterPreset() FilterPreset {
+	return FilterPreset{
+		Type:       "tcp",
+		Status:     "LISTEN",
+		Namespace:  NamespaceHost,
+		SortColumn: ColumnLocalPort,
+		SortAsc:    true,
+	}
+}
+
+// ShowsStats reports whether the preset shows statistics columns
+func (p FilterPreset) ShowsStats() bool {
+	for _, column := range p.Columns {
+		if slices.Contains(StatsColumns, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Presets is the versioned document of the saved presets
+type Presets struct {
+	Version int            `json:"version"`
+	Default string         `json:"default"` // Name of the preset applied at startup
+	Presets []FilterPreset `json:"presets"`
+}
+
+// presetMigrations upgrade the raw document of version i to i+1. Fields
+// added in later versions get their defaults here, so old files keep
+// their meaning.
+var presetMigrations = []func(doc map[string]any){
+	// 0 -> 1: first versioned document, fill the fields that may be missing
+	func(doc map[string]any) {
+		presets, _ := doc["presets"].([]any)
+		for _, item := range presets {
+			preset, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			setDefault(preset, "namespace", NamespaceHost)
+			setDefault(preset, "sort_column", ColumnLocalPort)
+			setDefault(preset, "sort_asc", true)
+		}
+	},
+}
+
+func setDefault(m map[string]any, key string, value any) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+// ErrPresetsTooNew is returned when saving a document written by a newer
+// version, which would lose the fields this version doesn't know
+var ErrPresetsTooNew = errors.New("presets were saved by a newer version")
+
+// LoadPresets reads the presets from the local storage. A missing file
+// gives an empty document.
+func LoadPresets() (*Presets, error) {
+	if !localstorage.Exists(presetsFileName) {
+		return &Presets{Version: PresetsVersion}, nil
+	}
+	data, err := localstorage.Read(presetsFileName)
+	if err != nil {
+		return nil, err
+	}
+	return parsePresets(data)
+}
+
+func parsePresets(data []byte) (*Presets, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", presetsFileName, err)
+	}
+
+	version := 0
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	for ; version < PresetsVersion && version < len(presetMigrations); version++ {
+		presetMigrations[version](doc)
+	}
+	if version < PresetsVersion {
+		version = PresetsVersion
+	}
+	doc["version"] = version
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var result Presets
+	if err := json.Unmarshal(migrated, &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", presetsFileName, err)
+	}
+	return &result, nil
+}
+
+// Save writes the presets to the local storage
+func (p *Presets) Save() error {
+	if p.Version > PresetsVersion {
+		return ErrPresetsTooNew
+	}
+	p.Version = PresetsVersion
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return localstorage.Write(presetsFileName, data)
+}
+
+func (p *Presets) Get(name string) (FilterPreset, bool) {
+	for _, preset := range p.Presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return FilterPreset{}, false
+}
+
+// Set adds the preset or replaces the one with the same name. Presets
+// are kept ordered by name.
+func (p *Presets) Set(preset FilterPreset) {
+	for i := range p.Presets {
+		if p.Presets[i].Name == preset.Name {
+			p.Presets[i] = preset
+			return
+		}
+	}
+	p.Presets = append(p.Presets, preset)
+	sort.Slice(p.Presets, func(i, j int) bool { return p.Presets[i].Name < p.Presets[j].Name })
+}
+
+// Delete removes a preset, and the startup default if it was the one
+func (p *Presets) Delete(name string) bool {
+	for i := range p.Presets {
+		if p.Presets[i].Name == name {
+			p.Presets = append(p.Presets[:i], p.Presets[i+1:]...)
+			if p.Default == name {
+				p.Default = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// StartupPreset returns the default preset, or DefaultFilterPreset when
+// none is chosen or it was deleted
+func (p *Presets) StartupPreset() FilterPreset {
+	if p.Default != "" {
+		if preset, ok := p.Get(p.Default); ok {
+			return preset
+		}
+	}
+	return DefaultFilterPreset()
+}
+
+func (p *Presets) Names() []string {
+	result := make([]string, 0, len(p.Presets))
+	for _, preset := range p.Presets {
+		result = append(result, preset.Name)
+	}
+	return result
+}
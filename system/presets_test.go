@@ -0,0 +1,113 @@
+package system
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParsePresetsMigratesVersion0(t *testing.T) {
+	// Written before the document had a version and these fields
+	p, err := parsePresets([]byte(`{
+		"default": "web",
+		"presets": [
+			{"name": "web", "type": "tcp", "status": "LISTEN", "query": "port:80,443"},
+			{"name": "desc", "type": "all", "status": "ALL", "sort_column": "pid", "sort_asc": false}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != PresetsVersion || p.Default != "web" || len(p.Presets) != 2 {
+		t.Fatalf("migrated %+v", p)
+	}
+	web := p.Presets[0]
+	if web.Namespace != NamespaceHost || web.SortColumn != ColumnLocalPort || !web.SortAsc || web.Query != "port:80,443" {
+		t.Errorf("web preset = %+v, want the defaults filled in", web)
+	}
+	// Values that were saved are kept
+	desc := p.Presets[1]
+	if desc.SortColumn != ColumnPID || desc.SortAsc {
+		t.Errorf("desc preset = %+v, want its sort order kept", desc)
+	}
+}
+
+func TestPresetsTooNew(t *testing.T) {
+	p, err := parsePresets([]byte(`{"version": 99, "presets": [{"name": "x", "future_field": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 99 {
+		t.Errorf("version = %d, want 99 kept", p.Version)
+	}
+	if err := p.Save(); !errors.Is(err, ErrPresetsTooNew) {
+		t.Errorf("Save of a newer document: %v, want %v", err, ErrPresetsTooNew)
+	}
+
+	if _, err := parsePresets([]byte(`{"presets": "none"}`)); err == nil {
+		t.Error("a damaged document was parsed")
+	}
+}
+
+func TestPresetsSetAndDelete(t *testing.T) {
+	p := &Presets{Version: PresetsVersion}
+	p.Set(FilterPreset{Name: "web", Query: "port:80"})
+	p.Set(FilterPreset{Name: "db", Query: "port:5432"})
+	p.Set(FilterPreset{Name: "mail", Query: "port:25"})
+	if names := p.Names(); !slices.Equal(names, []string{"db", "mail", "web"}) {
+		t.Errorf("names = %v, want sorted", names)
+	}
+
+	// Replaced in place, no second "mail"
+	p.Set(FilterPreset{Name: "mail", Query: "port:587"})
+	if names := p.Names(); !slices.Equal(names, []string{"db", "mail", "web"}) {
+		t.Errorf("names after replacing = %v", names)
+	}
+	if mail, _ := p.Get("mail"); mail.Query != "port:587" {
+		t.Errorf("mail = %+v, want the new query", mail)
+	}
+
+	p.Default = "mail"
+	if p.Delete("nothing") {
+		t.Error("deleted a missing preset")
+	}
+	if !p.Delete("db") || p.Default != "mail" {
+		t.Errorf("deleting another preset changed the default to %q", p.Default)
+	}
+	if !p.Delete("mail") || p.Default != "" {
+		t.Errorf("default after deleting it = %q", p.Default)
+	}
+	if names := p.Names(); !slices.Equal(names, []string{"web"}) {
+		t.Errorf("names after deleting = %v", names)
+	}
+}
+
+func TestStartupPreset(t *testing.T) {
+	p := &Presets{Version: PresetsVersion}
+	p.Set(FilterPreset{Name: "web", Type: "all", Query: "port:80"})
+
+	if got := p.StartupPreset(); got.Name != "" || got.Type != DefaultFilterPreset().Type {
+		t.Errorf("without a default: %+v", got)
+	}
+	p.Default = "web"
+	if got := p.StartupPreset(); got.Name != "web" || got.Query != "port:80" {
+		t.Errorf("with a default: %+v", got)
+	}
+	// Removed from the file by hand, the default points nowhere
+	p.Presets = nil
+	if got := p.StartupPreset(); got.Name != "" || got.Status != DefaultFilterPreset().Status {
+		t.Errorf("with a missing default: %+v", got)
+	}
+}
+
+func TestPresetShowsStats(t *testing.T) {
+	if (FilterPreset{}).ShowsStats() {
+		t.Error("default columns show statistics")
+	}
+	if (FilterPreset{Columns: []string{ColumnLocalPort, ColumnProgram}}).ShowsStats() {
+		t.Error("preset without statistics columns shows them")
+	}
+	if !(FilterPreset{Columns: []string{ColumnLocalPort, ColumnRTT}}).ShowsStats() {
+		t.Error("preset with RTT does not show statistics")
+	}
+}
@@ -0,0 +1,35 @@
+package system
+
+import "time"
+
+// ProcessInfo describes a running process. Fields that could not be read
+// (other users' processes, missing permissions) are left empty.
+type ProcessInfo struct {
+	PID         uint32
+	ParentPID   uint32
+	Name        string
+	ExePath     string
+	CommandLine string
+	User        string
+	StartTime   time.Time
+	Container   ContainerInfo // From the cgroup (Linux)
+}
+
+// SameProcess reports whether both describe the same process instance,
+// guarding against PID reuse when start times are known
+func (p ProcessInfo) SameProcess(other ProcessInfo) bool {
+	if p.PID != other.PID || p.Name != other.Name {
+		return false
+	}
+	if !p.StartTime.IsZero() && !other.StartTime.IsZero() {
+		return p.StartTime.Equal(other.StartTime)
+	}
+	return true
+}
+
+func processInfo(pid uint32) ProcessInfo {
+	if Instance == nil {
+		return ProcessInfo{PID: pid, Name: "?"}
+	}
+	return Instance.GetProcess(pid)
+}
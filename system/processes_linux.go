@@ -0,0 +1,13 @@
+package system
+
+func (c *System) updateProcesses() {
+	c.mtx.Lock()
+	prev := c.processesById
+	c.mtx.Unlock()
+
+	result := NewProcFS(ProcRoot).Processes(prev)
+
+	c.mtx.Lock()
+	c.processesById = result
+	c.mtx.Unlock()
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+package system
+
+func (c *System) updateProcesses() {
+	result := make(map[uint32]ProcessInfo)
+
+	c.mtx.Lock()
+	c.processesById = result
+	c.mtx.Unlock()
+}
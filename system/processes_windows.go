@@ -0,0 +1,126 @@
+package system
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func (c *System) updateProcesses() {
+	result := make(map[uint32]ProcessInfo)
+
+	c.mtx.Lock()
+	prev := c.processesById
+	c.mtx.Unlock()
+
+	handle, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err == nil {
+		var entry windows.ProcessEntry32
+		entry.Size = uint32(unsafe.Sizeof(entry))
+		err = windows.Process32First(handle, &entry)
+		for err == nil {
+			nameSize := 0
+			for i := 0; i < 260; i++ {
+				if entry.ExeFile[nameSize] == 0 {
+					break
+				}
+				nameSize++
+			}
+
+			var info ProcessInfo
+			info.PID = entry.ProcessID
+			info.ParentPID = entry.ParentProcessID
+			info.Name = syscall.UTF16ToString(entry.ExeFile[:nameSize])
+			info.StartTime = processStartTime(info.PID)
+
+			// Path, command line and user don't change, read them once per process
+			if old, ok := prev[info.PID]; ok && old.SameProcess(info) {
+				info.ExePath = old.ExePath
+				info.CommandLine = old.CommandLine
+				info.User = old.User
+			} else {
+				readProcessDetails(&info)
+			}
+
+			result[info.PID] = info
+			err = windows.Process32Next(handle, &entry)
+		}
+
+		_ = windows.CloseHandle(handle)
+	}
+
+	c.mtx.Lock()
+	c.processesById = result
+	c.mtx.Unlock()
+}
+
+func processStartTime(pid uint32) time.Time {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return time.Time{}
+	}
+	defer windows.CloseHandle(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	if windows.GetProcessTimes(h, &creation, &exit, &kernel, &user) != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, creation.Nanoseconds())
+}
+
+func readProcessDetails(info *ProcessInfo) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, info.PID)
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(h)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if windows.QueryFullProcessImageName(h, 0, &buf[0], &size) == nil {
+		info.ExePath = windows.UTF16ToString(buf[:size])
+	}
+
+	info.CommandLine = processCommandLine(h)
+	info.User = processUser(h)
+}
+
+func processCommandLine(h windows.Handle) string {
+	buf := make([]byte, 1024)
+	for {
+		var size uint32
+		err := windows.NtQueryInformationProcess(h, windows.ProcessCommandLineInformation, unsafe.Pointer(&buf[0]), uint32(len(buf)), &size)
+		if err == nil {
+			break
+		}
+		if err == windows.STATUS_INFO_LENGTH_MISMATCH && int(size) > len(buf) && size < 1<<20 {
+			buf = make([]byte, size)
+			continue
+		}
+		return ""
+	}
+	return (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0])).String()
+}
+
+func processUser(h windows.Handle) string {
+	var token windows.Token
+	if windows.OpenProcessToken(h, windows.TOKEN_QUERY, &token) != nil {
+		return ""
+	}
+	defer token.Close()
+
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		return ""
+	}
+	account, domain, _, err := tokenUser.User.Sid.LookupAccount("")
+	if err != nil {
+		return tokenUser.User.Sid.String()
+	}
+	if domain == "" {
+		return account
+	}
+	return domain + "\\" + account
+}
@@ -0,0 +1,381 @@
+package system
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcRoot is the procfs mount point used by the Linux collector.
+// It can be pointed at a fixture directory.
+var ProcRoot = "/proc"
+
+// ProcFS reads socket tables and process information from a procfs tree
+type ProcFS struct {
+	root string
+
+	// File access of the per-process files. Tests replace it to simulate
+	// processes that exit or deny access in the middle of a scan.
+	readFile func(name string) ([]byte, error)
+	readDir  func(name string) ([]os.DirEntry, error)
+	readLink func(name string) (string, error)
+}
+
+func NewProcFS(root string) *ProcFS {
+	var c ProcFS
+	c.root = root
+	c.readFile = os.ReadFile
+	c.readDir = os.ReadDir
+	c.readLink = os.Readlink
+	return &c
+}
+
+func (c *ProcFS) Root() string {
+	return c.root
+}
+
+// Connections parses net/tcp, net/tcp6, net/udp, net/udp6 and net/unix
+// of every network namespace that can be read and maps socket inodes to
+// the owning PIDs
+func (c *ProcFS) Connections() ([]ConnectionInfo, error) {
+	owners := c.SocketOwners()
+	self := c.SelfNetNS()
+
+	connections, err := c.namespaceConnections(filepath.Join(c.root, "net"), self, owners)
+	if err != nil {
+		return nil, err
+	}
+	connections = append(connections, c.OtherNamespaceConnections(self, owners)...)
+	return connections, nil
+}
+
+// namespaceConnections reads the tables of one namespace from netDir,
+// which is net of the procfs root or /proc/<pid>/net
+func (c *ProcFS) namespaceConnections(netDir string, netNS uint64, owners map[uint64]uint32) ([]ConnectionInfo, error) {
+	tables := []struct {
+		fileName string
+		protocol string
+	}{
+		{"tcp", "TCP"},
+		{"tcp6", "TCP"},
+		{"udp", "UDP"},
+		{"udp6", "UDP"},
+	}
+
+	var connections []ConnectionInfo
+	var lastErr error
+	readTables := 0
+	for _, table := range tables {
+		conns, err := c.readNetTable(filepath.Join(netDir, table.fileName), table.protocol, owners)
+		if err != nil {
+			// IPv6 may be disabled, so a missing table is not fatal
+			lastErr = err
+			continue
+		}
+		readTables++
+		connections = append(connections, conns...)
+	}
+
+	if readTables == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	// Interface names are only known for the namespace of this process
+	if netNS == c.SelfNetNS() {
+		addLinkLocalZones(connections)
+	}
+
+	if unixSockets, err := c.readUnixTable(filepath.Join(netDir, "unix"), owners); err == nil {
+		connections = append(connections, unixSockets...)
+	}
+
+	for i := range connections {
+		connections[i].NetNS = netNS
+	}
+	return connections, nil
+}
+
+// addLinkLocalZones adds the scope to link-local IPv6 addresses. The
+// tables carry no scope ID, so it is taken from the interface that owns
+// the local address; the peer is on the same link.
+func addLinkLocalZones(connections []ConnectionInfo) {
+	applyLinkLocalZones(connections, linkLocalZones())
+}
+
+// linkLocalZones maps the link-local addresses of the interfaces to the
+// interface names
+func linkLocalZones() map[netip.Addr]string {
+	zones := make(map[netip.Addr]string)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return zones
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			prefix, err := netip.ParsePrefix(addr.String())
+			if err != nil {
+				continue
+			}
+			if prefix.Addr().IsLinkLocalUnicast() {
+				zones[prefix.Addr()] = iface.Name
+			}
+		}
+	}
+	return zones
+}
+
+func applyLinkLocalZones(connections []ConnectionInfo, zones map[netip.Addr]string) {
+	for i := range connections {
+		conn := &connections[i]
+		local, err := netip.ParseAddr(conn.LocalAddr)
+		if err != nil || !local.Is6() || !local.IsLinkLocalUnicast() {
+			continue
+		}
+		zone, ok := zones[local]
+		if !ok {
+			continue
+		}
+		conn.LocalAddr = local.WithZone(zone).String()
+		if remote, err := netip.ParseAddr(conn.RemoteAddr); err == nil && remote.IsLinkLocalUnicast() {
+			conn.RemoteAddr = remote.WithZone(zone).String()
+		}
+	}
+}
+
+// SocketOwners maps socket inodes to PIDs by scanning /proc/<pid>/fd.
+// Processes that vanish or deny access are skipped.
+func (c *ProcFS) SocketOwners() map[uint64]uint32 {
+	result := make(map[uint64]uint32)
+
+	for _, pid := range c.pids() {
+		fdDir := filepath.Join(c.root, strconv.FormatUint(uint64(pid), 10), "fd")
+		fds, err := c.readDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := c.readLink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, ok := parseSocketLink(link)
+			if !ok {
+				continue
+			}
+			// systemd (PID 1) keeps activated sockets open, the
+			// service it passed them to is the more useful owner
+			if owner, exists := result[inode]; !exists || owner == 1 {
+				result[inode] = pid
+			}
+		}
+	}
+
+	return result
+}
+
+func (c *ProcFS) pids() []uint32 {
+	entries, err := os.ReadDir(c.root)
+	if err != nil {
+		return nil
+	}
+	result := make([]uint32, 0, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		result = append(result, uint32(pid))
+	}
+	return result
+}
+
+func (c *ProcFS) readNetTable(fileName string, protocol string, owners map[uint64]uint32) ([]ConnectionInfo, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var connections []ConnectionInfo
+	scanner := bufio.NewScanner(f)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		row, err := parseNetTableLine(scanner.Text(), protocol)
+		if err != nil {
+			continue
+		}
+		row.info.PID = owners[row.inode]
+		row.info.ProcessName = processName(row.info.PID)
+		row.info.Process = processInfo(row.info.PID)
+		connections = append(connections, row.info)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+type netTableRow struct {
+	info  ConnectionInfo
+	inode uint64
+}
+
+// parseNetTableLine parses one row of /proc/net/{tcp,tcp6,udp,udp6}:
+// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+func parseNetTableLine(line string, protocol string) (netTableRow, error) {
+	var row netTableRow
+
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return row, errors.New("short line")
+	}
+
+	localAddr, localPort, err := parseNetTableAddr(fields[1])
+	if err != nil {
+		return row, err
+	}
+	remoteAddr, remotePort, err := parseNetTableAddr(fields[2])
+	if err != nil {
+		return row, err
+	}
+	state, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return row, err
+	}
+	txQueue, rxQueue, ok := strings.Cut(fields[4], ":")
+	if !ok {
+		return row, fmt.Errorf("invalid queues: %s", fields[4])
+	}
+	sendQueue, err := strconv.ParseUint(txQueue, 16, 32)
+	if err != nil {
+		return row, err
+	}
+	recvQueue, err := strconv.ParseUint(rxQueue, 16, 32)
+	if err != nil {
+		return row, err
+	}
+	retransmits, err := strconv.ParseUint(fields[6], 16, 32)
+	if err != nil {
+		return row, err
+	}
+	inode, err := strconv.ParseUint(fields[9], 10, 64)
+	if err != nil {
+		return row, err
+	}
+
+	row.inode = inode
+	row.info.Inode = inode
+	row.info.Protocol = protocol
+	row.info.LocalAddr = localAddr
+	row.info.LocalPort = localPort
+	row.info.Stats = &ConnectionStats{
+		SendQueue:   uint32(sendQueue),
+		RecvQueue:   uint32(recvQueue),
+		Retransmits: uint32(retransmits),
+	}
+
+	if protocol == "TCP" {
+		row.info.RemoteAddr = remoteAddr
+		row.info.RemotePort = remotePort
+		row.info.State = tcpStateToString(linuxTCPStateToMIB(uint32(state)))
+	} else if remotePort != 0 {
+		// connected UDP socket
+		row.info.RemoteAddr = remoteAddr
+		row.info.RemotePort = remotePort
+	}
+
+	return row, nil
+}
+
+// parseNetTableAddr decodes "0100007F:0277" style addresses. Every 32-bit
+// word of the address is printed in host byte order.
+func parseNetTableAddr(s string) (string, uint16, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address: %s", s)
+	}
+
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return "", 0, fmt.Errorf("invalid address length: %s", s)
+	}
+
+	var ip [16]byte
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(raw) == net.IPv4len {
+		return netip.AddrFrom4([4]byte(ip[:4])).String(), uint16(port), nil
+	}
+	return addr6ToString(ip, ""), uint16(port), nil
+}
+
+// parseSocketLink extracts the inode from a "socket:[12345]" fd link
+func parseSocketLink(link string) (uint64, bool) {
+	if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
+
+// linuxTCPStateToMIB converts kernel TCP states (include/net/tcp_states.h)
+// to MIB_TCP_STATE values so tcpStateToString gives the same names on
+// every platform
+func linuxTCPStateToMIB(state uint32) uint32 {
+	switch state {
+	case 1: // TCP_ESTABLISHED
+		return 5
+	case 2: // TCP_SYN_SENT
+		return 3
+	case 3: // TCP_SYN_RECV
+		return 4
+	case 4: // TCP_FIN_WAIT1
+		return 6
+	case 5: // TCP_FIN_WAIT2
+		return 7
+	case 6: // TCP_TIME_WAIT
+		return 11
+	case 7: // TCP_CLOSE
+		return 1
+	case 8: // TCP_CLOSE_WAIT
+		return 8
+	case 9: // TCP_LAST_ACK
+		return 10
+	case 10: // TCP_LISTEN
+		return 2
+	case 11: // TCP_CLOSING
+		return 9
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,99 @@
+package system
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NetNamespace is a network namespace and one process that lives in it
+type NetNamespace struct {
+	Inode uint64
+	PID   uint32
+}
+
+// NetNamespaces finds the distinct network namespaces through
+// /proc/<pid>/ns/net, ordered by inode. Processes whose namespace link
+// can't be read are skipped.
+func (c *ProcFS) NetNamespaces() []NetNamespace {
+	seen := make(map[uint64]uint32)
+	for _, pid := range c.pids() {
+		link, err := c.readLink(filepath.Join(c.processDir(pid), "ns", "net"))
+		if err != nil {
+			continue
+		}
+		inode, ok := parseNamespaceLink(link)
+		if !ok {
+			continue
+		}
+		if _, exists := seen[inode]; !exists {
+			seen[inode] = pid
+		}
+	}
+
+	result := make([]NetNamespace, 0, len(seen))
+	for inode, pid := range seen {
+		result = append(result, NetNamespace{Inode: inode, PID: pid})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Inode < result[j].Inode })
+	return result
+}
+
+// OtherNamespaceConnections reads the sockets of all namespaces except
+// skip through a process of each. Namespaces that can't be read (other
+// users' processes without privileges) are left out.
+func (c *ProcFS) OtherNamespaceConnections(skip uint64, owners map[uint64]uint32) []ConnectionInfo {
+	var result []ConnectionInfo
+	for _, ns := range c.NetNamespaces() {
+		if ns.Inode == skip {
+			continue
+		}
+		conns, err := c.namespaceConnections(filepath.Join(c.processDir(ns.PID), "net"), ns.Inode, owners)
+		if err != nil {
+			continue
+		}
+		result = append(result, conns...)
+	}
+	return result
+}
+
+// SelfNetNS returns the network namespace of this process, 0 if unknown
+func (c *ProcFS) SelfNetNS() uint64 {
+	return c.namespaceOf("self")
+}
+
+// HostNetNS returns the network namespace of init, falling back to the
+// one of this process
+func (c *ProcFS) HostNetNS() uint64 {
+	if inode := c.namespaceOf("1"); inode != 0 {
+		return inode
+	}
+	return c.SelfNetNS()
+}
+
+func (c *ProcFS) namespaceOf(process string) uint64 {
+	link, err := c.readLink(filepath.Join(c.root, process, "ns", "net"))
+	if err != nil {
+		return 0
+	}
+	inode, _ := parseNamespaceLink(link)
+	return inode
+}
+
+// parseNamespaceLink parses "net:[4026531840]"
+func parseNamespaceLink(link string) (uint64, bool) {
+	s, ok := strings.CutPrefix(link, "net:[")
+	if !ok {
+		return 0, false
+	}
+	s, ok = strings.CutSuffix(s, "]")
+	if !ok {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
@@ -0,0 +1,196 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the start time in /proc/<pid>/stat.
+// It is 100 on every Linux architecture in use.
+const clockTicks = 100
+
+var userNamesMtx sync.Mutex
+var userNames = make(map[string]string)
+
+// Processes reads all processes. Details of processes found in prev with
+// the same start time are reused instead of being read again. Processes
+// that exit during the scan are skipped, fields that can't be read because
+// of permissions are left empty.
+func (c *ProcFS) Processes(prev map[uint32]ProcessInfo) map[uint32]ProcessInfo {
+	result := make(map[uint32]ProcessInfo)
+	bootTime := c.bootTime()
+
+	for _, pid := range c.pids() {
+		info, err := c.processBase(pid, bootTime)
+		if err != nil {
+			continue
+		}
+		if old, ok := prev[pid]; ok && old.SameProcess(info) {
+			info.ExePath = old.ExePath
+			info.CommandLine = old.CommandLine
+			info.User = old.User
+			info.Container = old.Container
+		} else {
+			c.readProcessDetails(&info)
+		}
+		result[pid] = info
+	}
+
+	return result
+}
+
+// Process reads a single process
+func (c *ProcFS) Process(pid uint32) (ProcessInfo, error) {
+	info, err := c.processBase(pid, c.bootTime())
+	if err != nil {
+		return info, err
+	}
+	c.readProcessDetails(&info)
+	return info, nil
+}
+
+func (c *ProcFS) processDir(pid uint32) string {
+	return filepath.Join(c.root, strconv.FormatUint(uint64(pid), 10))
+}
+
+// processBase reads the name, parent and start time, which are
+// readable for every process
+func (c *ProcFS) processBase(pid uint32, bootTime time.Time) (ProcessInfo, error) {
+	var info ProcessInfo
+	info.PID = pid
+	dir := c.processDir(pid)
+
+	comm, err := c.readFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return info, err
+	}
+	info.Name = strings.TrimSuffix(string(comm), "\n")
+
+	stat, err := c.readFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return info, err
+	}
+	ppid, startTicks, err := parseProcStat(string(stat))
+	if err != nil {
+		return info, err
+	}
+	info.ParentPID = ppid
+	if !bootTime.IsZero() {
+		info.StartTime = bootTime.Add(time.Duration(startTicks) * time.Second / clockTicks)
+	}
+
+	return info, nil
+}
+
+func (c *ProcFS) readProcessDetails(info *ProcessInfo) {
+	dir := c.processDir(info.PID)
+
+	// exe is not readable for other users' processes without privileges
+	if exe, err := c.readLink(filepath.Join(dir, "exe")); err == nil {
+		info.ExePath = strings.TrimSuffix(exe, " (deleted)")
+	}
+
+	if cmdline, err := c.readFile(filepath.Join(dir, "cmdline")); err == nil {
+		cmdline = bytes.TrimRight(cmdline, "\x00")
+		info.CommandLine = strings.ReplaceAll(string(cmdline), "\x00", " ")
+	}
+
+	if uid, err := c.processUid(dir); err == nil {
+		info.User = userName(uid)
+	}
+
+	if cgroup, err := c.readFile(filepath.Join(dir, "cgroup")); err == nil {
+		info.Container = parseCgroup(string(cgroup))
+	}
+}
+
+// parseProcStat returns ppid (field 4) and starttime (field 22). The
+// command in field 2 may contain spaces and parentheses, so fields are
+// counted after the last ')'.
+func parseProcStat(stat string) (uint32, uint64, error) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, 0, errors.New("invalid stat")
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return 0, 0, errors.New("short stat")
+	}
+	ppid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	startTicks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(ppid), startTicks, nil
+}
+
+func (c *ProcFS) processUid(dir string) (string, error) {
+	status, err := c.readFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+		if len(fields) == 0 {
+			break
+		}
+		return fields[0], nil
+	}
+	return "", fmt.Errorf("no Uid in %s/status", dir)
+}
+
+// bootTime reads btime from /proc/stat
+func (c *ProcFS) bootTime() time.Time {
+	f, err := os.Open(filepath.Join(c.root, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "btime ")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			break
+		}
+		return time.Unix(seconds, 0)
+	}
+	return time.Time{}
+}
+
+func userName(uid string) string {
+	userNamesMtx.Lock()
+	defer userNamesMtx.Unlock()
+
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
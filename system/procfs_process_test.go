@@ -0,0 +1,188 @@
+package system
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fixtureBootTime is btime of testdata/proc/stat
+var fixtureBootTime = time.Unix(1700000000, 0)
+
+// faultyProcFS reads the fixture tree, failing the reads of the given
+// paths (relative to the tree, e.g. "300/exe") with their error
+func faultyProcFS(faults map[string]error) *ProcFS {
+	c := NewProcFS(fixtureProc)
+	fault := func(op string, name string) error {
+		rel, err := filepath.Rel(fixtureProc, name)
+		if err != nil {
+			return nil
+		}
+		if err, ok := faults[filepath.ToSlash(rel)]; ok {
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		return nil
+	}
+	c.readFile = func(name string) ([]byte, error) {
+		if err := fault("open", name); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(name)
+	}
+	c.readDir = func(name string) ([]os.DirEntry, error) {
+		if err := fault("open", name); err != nil {
+			return nil, err
+		}
+		return os.ReadDir(name)
+	}
+	c.readLink = func(name string) (string, error) {
+		if err := fault("readlink", name); err != nil {
+			return "", err
+		}
+		return os.Readlink(name)
+	}
+	return c
+}
+
+// foreignProcess are the files of PID 300 that only root may read
+var foreignProcess = map[string]error{
+	"300/exe":     syscall.EACCES,
+	"300/cmdline": syscall.EACCES,
+	"300/fd":      syscall.EACCES,
+}
+
+func TestProcesses(t *testing.T) {
+	faults := map[string]error{
+		"500/stat": syscall.ENOENT, // Exited between reading comm and stat
+	}
+	for name, err := range foreignProcess {
+		faults[name] = err
+	}
+	processes := faultyProcFS(faults).Processes(nil)
+
+	want := []ProcessInfo{
+		{
+			PID:         1,
+			Name:        "systemd",
+			ExePath:     "/usr/lib/systemd/systemd",
+			CommandLine: "/sbin/init splash",
+			User:        userName("0"),
+			StartTime:   fixtureBootTime.Add(10 * time.Millisecond),
+			Container:   ContainerInfo{Unit: "init.scope"},
+		},
+		{
+			PID:         100,
+			ParentPID:   1,
+			Name:        "nginx",
+			ExePath:     "/usr/sbin/nginx", // " (deleted)" is dropped
+			CommandLine: "nginx: master process /usr/sbin/nginx -g daemon off;",
+			User:        userName("0"),
+			StartTime:   fixtureBootTime.Add(5 * time.Second),
+			Container:   ContainerInfo{Unit: "nginx.service"},
+		},
+		{
+			PID:         200,
+			ParentPID:   100,
+			Name:        "my (server)",
+			ExePath:     "/opt/app/server",
+			CommandLine: "/opt/app/server --port 8080",
+			User:        userName("1000"),
+			StartTime:   fixtureBootTime.Add(123450 * time.Millisecond),
+			Container:   parseCgroup("0::/user.slice/user-1000.slice/session-2.scope\n"),
+		},
+		{
+			// Another user's process: path and command line are denied
+			PID:       300,
+			ParentPID: 1,
+			Name:      "postgres",
+			User:      userName("999"),
+			StartTime: fixtureBootTime.Add(7 * time.Second),
+			Container: ContainerInfo{Unit: "postgresql.service"},
+		},
+	}
+
+	// 400 has no comm left and 500 vanished during the scan
+	if len(processes) != len(want) {
+		t.Errorf("got %d processes, want %d", len(processes), len(want))
+	}
+	for _, expected := range want {
+		got, ok := processes[expected.PID]
+		if !ok {
+			t.Errorf("process %d is missing", expected.PID)
+			continue
+		}
+		if !got.StartTime.Equal(expected.StartTime) {
+			t.Errorf("process %d started at %v, want %v", expected.PID, got.StartTime, expected.StartTime)
+		}
+		got.StartTime = expected.StartTime
+		if got != expected {
+			t.Errorf("process %d = %+v, want %+v", expected.PID, got, expected)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	c := faultyProcFS(map[string]error{"500/stat": syscall.ENOENT})
+
+	if _, err := c.Process(400); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Process(400) error = %v, want not exist", err)
+	}
+	if _, err := c.Process(500); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Process(500) error = %v, want not exist", err)
+	}
+
+	// Denied details are no error, the fields stay empty
+	p, err := faultyProcFS(foreignProcess).Process(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "postgres" || p.ExePath != "" || p.CommandLine != "" {
+		t.Errorf("Process(300) = %+v", p)
+	}
+}
+
+func TestProcessesReusesDetails(t *testing.T) {
+	c := NewProcFS(fixtureProc)
+	prev := c.Processes(nil)
+
+	exeReads := 0
+	c.readLink = func(name string) (string, error) {
+		if filepath.Base(name) == "exe" {
+			exeReads++
+		}
+		return os.Readlink(name)
+	}
+	c.Processes(prev)
+	if exeReads != 0 {
+		t.Errorf("read exe %d times for unchanged processes", exeReads)
+	}
+
+	// A PID reused by a new process is read again
+	changed := prev[100]
+	changed.StartTime = changed.StartTime.Add(time.Hour)
+	changed.ExePath = "/old/path"
+	prev[100] = changed
+	processes := c.Processes(prev)
+	if exeReads != 1 || processes[100].ExePath != "/usr/sbin/nginx" {
+		t.Errorf("reused PID: %d exe reads, path %q", exeReads, processes[100].ExePath)
+	}
+}
+
+func TestSocketOwnersAccessDenied(t *testing.T) {
+	owners := faultyProcFS(foreignProcess).SocketOwners()
+
+	// Without the fds of 300, systemd keeps the activated socket
+	if owners[3001] != 1 {
+		t.Errorf("owner of socket 3001 = %d, want 1", owners[3001])
+	}
+	if pid, ok := owners[4001]; ok {
+		t.Errorf("socket 4001 has owner %d, want none", pid)
+	}
+	if owners[1001] != 100 {
+		t.Errorf("owner of socket 1001 = %d, want 100", owners[1001])
+	}
+}
@@ -0,0 +1,143 @@
+package system
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureProc is a procfs tree with the tables of a little-endian host
+var fixtureProc = filepath.Join("testdata", "proc")
+
+// skipBigEndian skips tests of fixtures in the byte order of x86 and arm64
+func skipBigEndian(t *testing.T) {
+	var word [4]byte
+	binary.NativeEndian.PutUint32(word[:], 1)
+	if word[0] != 1 {
+		t.Skip("fixtures are written in little-endian byte order")
+	}
+}
+
+func TestParseNetTableAddr(t *testing.T) {
+	skipBigEndian(t)
+	tests := []struct {
+		in   string
+		addr string
+		port uint16
+	}{
+		{"0100007F:1F90", "127.0.0.1", 8080},
+		{"00000000:0000", "0.0.0.0", 0},
+		{"0A01A8C0:01BB", "192.168.1.10", 443},
+		{"00000000000000000000000000000000:01BB", "::", 443},
+		{"00000000000000000000000001000000:14E9", "::1", 5353},
+		// IPv4-mapped addresses of dual-stack sockets are shown as IPv4
+		{"0000000000000000FFFF00000100007F:1F90", "127.0.0.1", 8080},
+		{"000080FE000000000000000078563412:0016", "fe80::1234:5678", 22},
+	}
+	for _, test := range tests {
+		addr, port, err := parseNetTableAddr(test.in)
+		if err != nil {
+			t.Errorf("parseNetTableAddr(%q): %v", test.in, err)
+			continue
+		}
+		if addr != test.addr || port != test.port {
+			t.Errorf("parseNetTableAddr(%q) = %s, %d, want %s, %d", test.in, addr, port, test.addr, test.port)
+		}
+	}
+
+	for _, in := range []string{"0100007F", "0100007F:XYZ", "01007F:0050", "ZZ00007F:0050"} {
+		if _, _, err := parseNetTableAddr(in); err == nil {
+			t.Errorf("parseNetTableAddr(%q) succeeded", in)
+		}
+	}
+}
+
+func TestParseUnixLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		path       string
+		socketType string
+		state      string
+		inode      uint64
+	}{
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 5001 /run/app.sock", "/run/app.sock", "STREAM", "LISTEN", 5001},
+		{"0000000000000000: 00000003 00000000 00000000 0001 03 5002", "", "STREAM", "ESTABLISHED", 5002},
+		{"0000000000000000: 00000002 00000000 00000000 0002 01 5003 @abstract name", "@abstract name", "DGRAM", "UNCONNECTED", 5003},
+		{"0000000000000000: 00000002 00000000 00000000 0005 01 5004 /run/seq path.sock", "/run/seq path.sock", "SEQPACKET", "UNCONNECTED", 5004},
+	}
+	for _, test := range tests {
+		row, err := parseUnixLine(test.line)
+		if err != nil {
+			t.Errorf("parseUnixLine(%q): %v", test.line, err)
+			continue
+		}
+		info := row.info
+		if info.LocalAddr != test.path || info.SocketType != test.socketType || info.State != test.state || row.inode != test.inode {
+			t.Errorf("parseUnixLine(%q) = %q %s %s %d, want %q %s %s %d", test.line,
+				info.LocalAddr, info.SocketType, info.State, row.inode,
+				test.path, test.socketType, test.state, test.inode)
+		}
+	}
+}
+
+func TestApplyLinkLocalZones(t *testing.T) {
+	zones := map[netip.Addr]string{
+		netip.MustParseAddr("fe80::1234:5678"): "eth0",
+	}
+	conns := []ConnectionInfo{
+		{LocalAddr: "fe80::1234:5678", RemoteAddr: "fe80::9abc:def0"},
+		{LocalAddr: "fe80::1234:5678", RemoteAddr: "2001:db8::1"},
+		{LocalAddr: "fe80::1", RemoteAddr: "fe80::2"},
+		{LocalAddr: "127.0.0.1", RemoteAddr: "127.0.0.1"},
+	}
+	applyLinkLocalZones(conns, zones)
+
+	want := [][2]string{
+		{"fe80::1234:5678%eth0", "fe80::9abc:def0%eth0"},
+		{"fe80::1234:5678%eth0", "2001:db8::1"},
+		{"fe80::1", "fe80::2"}, // No interface owns it
+		{"127.0.0.1", "127.0.0.1"},
+	}
+	for i, conn := range conns {
+		if conn.LocalAddr != want[i][0] || conn.RemoteAddr != want[i][1] {
+			t.Errorf("connection %d = %s -> %s, want %s -> %s", i, conn.LocalAddr, conn.RemoteAddr, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestSocketOwners(t *testing.T) {
+	owners := NewProcFS(fixtureProc).SocketOwners()
+	want := map[uint64]uint32{
+		1001: 100,
+		2001: 100,
+		1002: 200,
+		5001: 200,
+		2003: 200,
+		3001: 300, // Passed on by systemd, the service is the owner
+		4001: 300,
+	}
+	if len(owners) != len(want) {
+		t.Errorf("SocketOwners() = %v, want %v", owners, want)
+	}
+	for inode, pid := range want {
+		if owners[inode] != pid {
+			t.Errorf("owner of socket %d = %d, want %d", inode, owners[inode], pid)
+		}
+	}
+}
+
+func TestParseNetTableStats(t *testing.T) {
+	row, err := parseNetTableLine("   1: 0500000A:C350 0A01A8C0:01BB 01 00000010:00000020 02:000000A0 00000003  1000        0 1002 1", "TCP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := row.info.Stats
+	if stats == nil || stats.SendQueue != 16 || stats.RecvQueue != 32 || stats.Retransmits != 3 {
+		t.Errorf("stats = %+v, want send 16, recv 32, retransmits 3", stats)
+	}
+
+	if _, err := parseNetTableLine("   3: this line is broken", "TCP"); err == nil {
+		t.Error("broken line was parsed")
+	}
+}
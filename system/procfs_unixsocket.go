@@ -0,0 +1,124 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// unixAcceptCon is __SO_ACCEPTCON in the flags of net/unix, set for
+// listening sockets
+const unixAcceptCon = 0x10000
+
+// UnixSockets parses net/unix. The path of the socket is stored as the
+// local address; abstract names start with "@".
+func (c *ProcFS) UnixSockets(owners map[uint64]uint32) ([]ConnectionInfo, error) {
+	return c.readUnixTable(filepath.Join(c.root, "net", "unix"), owners)
+}
+
+func (c *ProcFS) readUnixTable(fileName string, owners map[uint64]uint32) ([]ConnectionInfo, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var connections []ConnectionInfo
+	scanner := bufio.NewScanner(f)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		row, err := parseUnixLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+		row.info.PID = owners[row.inode]
+		row.info.ProcessName = processName(row.info.PID)
+		row.info.Process = processInfo(row.info.PID)
+		connections = append(connections, row.info)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+// parseUnixLine parses one row of /proc/net/unix:
+// Num RefCount Protocol Flags Type St Inode Path
+func parseUnixLine(line string) (netTableRow, error) {
+	var row netTableRow
+
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return row, errors.New("short line")
+	}
+
+	flags, err := strconv.ParseUint(fields[3], 16, 32)
+	if err != nil {
+		return row, err
+	}
+	socketType, err := strconv.ParseUint(fields[4], 16, 16)
+	if err != nil {
+		return row, err
+	}
+	state, err := strconv.ParseUint(fields[5], 16, 8)
+	if err != nil {
+		return row, err
+	}
+	inode, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return row, err
+	}
+
+	row.inode = inode
+	row.info.Protocol = "UNIX"
+	row.info.Inode = inode
+	row.info.SocketType = unixSocketTypeToString(socketType)
+	if len(fields) > 7 {
+		row.info.LocalAddr = strings.Join(fields[7:], " ")
+	}
+	if flags&unixAcceptCon != 0 {
+		row.info.State = "LISTEN"
+	} else {
+		row.info.State = unixStateToString(state)
+	}
+
+	return row, nil
+}
+
+func unixSocketTypeToString(socketType uint64) string {
+	switch socketType {
+	case 1:
+		return "STREAM"
+	case 2:
+		return "DGRAM"
+	case 5:
+		return "SEQPACKET"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// unixStateToString names the socket_state values (SS_*). Connected
+// sockets are shown as ESTABLISHED, like TCP.
+func unixStateToString(state uint64) string {
+	switch state {
+	case 1:
+		return "UNCONNECTED"
+	case 2:
+		return "CONNECTING"
+	case 3:
+		return "ESTABLISHED"
+	case 4:
+		return "DISCONNECTING"
+	default:
+		return "UNKNOWN"
+	}
+}
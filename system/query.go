@@ -0,0 +1,330 @@
+package system
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query is a parsed search of the connection table. It is a list of terms
+// that must all match:
+//
+//	port:5432 proc:postgres !state:TIME_WAIT remote:10.0.0.0/8 country:DE
+//
+// A term is key:value, optionally negated with "!" or "-". Values may be
+// quoted ("a b") and list alternatives separated by commas
+// (port:80,443); ports also take ranges (port:8000-8100). A word without
+// a known key searches program, addresses, ports, service, country and
+// container.
+type Query struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	key    string
+	negate bool
+	values []queryValue
+}
+
+// queryValue is one alternative of a term, parsed for its key
+type queryValue struct {
+	text   string // Lower case, except for netns names
+	minVal uint64
+	maxVal uint64
+	prefix netip.Prefix
+}
+
+// QueryError points at the part of the query that can't be parsed.
+// Pos is the byte offset in the query.
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// queryKeys maps the keys and their aliases to the canonical key
+var queryKeys = map[string]string{
+	"port":      "port",
+	"lport":     "lport",
+	"rport":     "rport",
+	"proc":      "proc",
+	"program":   "proc",
+	"pid":       "pid",
+	"user":      "user",
+	"state":     "state",
+	"status":    "state",
+	"proto":     "proto",
+	"type":      "proto",
+	"local":     "local",
+	"remote":    "remote",
+	"country":   "country",
+	"service":   "service",
+	"container": "container",
+	"netns":     "netns",
+}
+
+// QueryKeys returns the keys understood by ParseQuery
+func QueryKeys() []string {
+	result := make([]string, 0, len(queryKeys))
+	for key := range queryKeys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ParseQuery parses a search. An empty query matches everything.
+func ParseQuery(s string) (*Query, error) {
+	var q Query
+	pos := 0
+	for {
+		for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t') {
+			pos++
+		}
+		if pos >= len(s) {
+			break
+		}
+		term, next, err := parseQueryTerm(s, pos)
+		if err != nil {
+			return nil, err
+		}
+		q.terms = append(q.terms, term)
+		pos = next
+	}
+	return &q, nil
+}
+
+func parseQueryTerm(s string, start int) (queryTerm, int, error) {
+	var term queryTerm
+	pos := start
+	if s[pos] == '!' || s[pos] == '-' {
+		term.negate = true
+		pos++
+	}
+
+	// key:value, or a bare word
+	keyStart := pos
+	for pos < len(s) && s[pos] != ':' && s[pos] != ' ' && s[pos] != '\t' && s[pos] != '"' {
+		pos++
+	}
+	valueStart := keyStart
+	// Only known keys start a key:value term, addresses like ::1,
+	// dead:beef::1 or 10.0.0.1:80 are search text
+	key, isKey := queryKeys[strings.ToLower(s[keyStart:pos])]
+	if pos < len(s) && s[pos] == ':' && isKey {
+		term.key = key
+		pos++
+		valueStart = pos
+	} else {
+		pos = keyStart
+	}
+
+	raw, next, err := readQueryValue(s, pos)
+	if err != nil {
+		return term, 0, err
+	}
+	if raw == "" {
+		if term.key == "" {
+			return term, 0, &QueryError{start, "missing search text after \"!\""}
+		}
+		return term, 0, &QueryError{valueStart, fmt.Sprintf("missing value for %s:", term.key)}
+	}
+
+	alternatives := []string{raw}
+	if term.key != "" {
+		alternatives = strings.Split(raw, ",")
+	}
+	for _, alternative := range alternatives {
+		value, err := parseQueryValue(term.key, alternative)
+		if err != nil {
+			return term, 0, &QueryError{valueStart, err.Error()}
+		}
+		term.values = append(term.values, value)
+	}
+	return term, next, nil
+}
+
+// readQueryValue reads up to the next blank, or a quoted string
+func readQueryValue(s string, pos int) (string, int, error) {
+	if pos < len(s) && s[pos] == '"' {
+		end := strings.IndexByte(s[pos+1:], '"')
+		if end < 0 {
+			return "", 0, &QueryError{pos, "missing closing quote"}
+		}
+		return s[pos+1 : pos+1+end], pos + end + 2, nil
+	}
+	start := pos
+	for pos < len(s) && s[pos] != ' ' && s[pos] != '\t' {
+		pos++
+	}
+	return s[start:pos], pos, nil
+}
+
+func parseQueryValue(key string, s string) (queryValue, error) {
+	value := queryValue{text: strings.ToLower(s)}
+	if s == "" {
+		return value, fmt.Errorf("empty value in list for %s:", key)
+	}
+
+	switch key {
+	case "port", "lport", "rport":
+		low, high, found := strings.Cut(s, "-")
+		if !found {
+			high = low
+		}
+		minPort, err := strconv.ParseUint(low, 10, 16)
+		if err != nil {
+			return value, fmt.Errorf("invalid port %q", s)
+		}
+		maxPort, err := strconv.ParseUint(high, 10, 16)
+		if err != nil || maxPort < minPort {
+			return value, fmt.Errorf("invalid port range %q", s)
+		}
+		value.minVal, value.maxVal = minPort, maxPort
+	case "pid":
+		pid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return value, fmt.Errorf("invalid pid %q", s)
+		}
+		value.minVal, value.maxVal = pid, pid
+	case "local", "remote":
+		prefix, err := parseRemoteFilter(s)
+		if err != nil {
+			return value, fmt.Errorf("invalid %s address or CIDR %q", key, s)
+		}
+		value.prefix = prefix
+	case "netns":
+		value.text = s
+	case "proto":
+		if value.text != "tcp" && value.text != "udp" && value.text != "unix" {
+			return value, fmt.Errorf("invalid protocol %q, use tcp, udp or unix", s)
+		}
+	}
+	return value, nil
+}
+
+// Match reports whether the connection matches all terms
+func (q *Query) Match(conn ConnectionInfo) bool {
+	for _, term := range q.terms {
+		if term.match(conn) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the query has no terms
+func (q *Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+func (t queryTerm) match(conn ConnectionInfo) bool {
+	for _, value := range t.values {
+		if value.match(t.key, conn) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v queryValue) match(key string, conn ConnectionInfo) bool {
+	switch key {
+	case "":
+		return v.matchText(conn)
+	case "port":
+		return v.inRange(uint64(conn.LocalPort)) || (conn.RemotePort != 0 && v.inRange(uint64(conn.RemotePort)))
+	case "lport":
+		return conn.Protocol != "UNIX" && v.inRange(uint64(conn.LocalPort))
+	case "rport":
+		return conn.RemotePort != 0 && v.inRange(uint64(conn.RemotePort))
+	case "pid":
+		return v.inRange(uint64(conn.PID))
+	case "proc":
+		return containsFold(conn.ProcessName, v.text)
+	case "user":
+		return containsFold(conn.Process.User, v.text)
+	case "state":
+		return strings.ToLower(conn.State) == v.text
+	case "proto":
+		return strings.ToLower(conn.Protocol) == v.text
+	case "local":
+		return v.matchAddress(conn.LocalAddr)
+	case "remote":
+		return v.matchAddress(conn.RemoteAddr)
+	case "country":
+		iso, _ := GetCountryISOCodeByIP(conn.RemoteAddr)
+		country, _ := GetCountryByIP(conn.RemoteAddr)
+		return matchCountry(iso, country, v.text)
+	case "service":
+		return containsFold(serviceByConnection(conn), v.text)
+	case "container":
+		return MatchContainer(conn, v.text)
+	case "netns":
+		return MatchNamespace(conn, v.text)
+	}
+	return false
+}
+
+// matchCountry compares the ISO code or the full name of a country with
+// the lower case text. Substrings would make DE match Sweden.
+func matchCountry(iso string, name string, text string) bool {
+	return (iso != "" && strings.EqualFold(iso, text)) || (name != "" && strings.EqualFold(name, text))
+}
+
+func (v queryValue) inRange(n uint64) bool {
+	return n >= v.minVal && n <= v.maxVal
+}
+
+func (v queryValue) matchAddress(addr string) bool {
+	ip, ok := ParseAddr(addr)
+	return ok && v.prefix.Contains(ip.WithZone(""))
+}
+
+// matchText searches the columns of the table for a bare word
+func (v queryValue) matchText(conn ConnectionInfo) bool {
+	fields := []string{
+		conn.ProcessName,
+		conn.LocalAddr,
+		conn.RemoteAddr,
+		strconv.FormatUint(uint64(conn.LocalPort), 10),
+		conn.State,
+		serviceByConnection(conn),
+		ContainerLabel(conn),
+	}
+	if conn.RemotePort != 0 {
+		fields = append(fields, strconv.FormatUint(uint64(conn.RemotePort), 10))
+	}
+	if country, err := GetCountryByIP(conn.RemoteAddr); err == nil {
+		fields = append(fields, country)
+	}
+	for _, field := range fields {
+		if containsFold(field, v.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether s contains the lower case substr,
+// ignoring case
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), substr)
+}
+
+func FilterQuery(conns []ConnectionInfo, q *Query) []ConnectionInfo {
+	if q == nil || q.Empty() {
+		return conns
+	}
+	result := make([]ConnectionInfo, 0)
+	for _, conn := range conns {
+		if q.Match(conn) {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
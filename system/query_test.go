@@ -0,0 +1,163 @@
+package system
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMatchCountry(t *testing.T) {
+	tests := []struct {
+		iso  string
+		name string
+		text string
+		want bool
+	}{
+		{"DE", "Germany", "de", true},
+		{"DE", "Germany", "germany", true},
+		{"SE", "Sweden", "de", false},
+		{"BD", "Bangladesh", "de", false},
+		{"US", "United States", "united states", true},
+		{"US", "United States", "united", false},
+		{"", "", "", false},
+	}
+	for _, test := range tests {
+		if got := matchCountry(test.iso, test.name, test.text); got != test.want {
+			t.Errorf("matchCountry(%q, %q, %q) = %v, want %v", test.iso, test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryAddresses(t *testing.T) {
+	conns := []ConnectionInfo{
+		{Protocol: "TCP", LocalAddr: "abcd::1", LocalPort: 80},
+		{Protocol: "TCP", LocalAddr: "fe::1", LocalPort: 81},
+		{Protocol: "TCP", LocalAddr: "dead:beef::1", LocalPort: 82},
+		{Protocol: "TCP", LocalAddr: "10.0.0.1", LocalPort: 8080},
+	}
+	tests := []struct {
+		query string
+		ports []uint16
+	}{
+		{"abcd::1", []uint16{80}},
+		{"fe::1", []uint16{81}},
+		{"dead:beef::1", []uint16{82}},
+		{"!dead:beef::1", []uint16{80, 81, 8080}},
+		{"10.0.0.1:8080", nil}, // The table has no address:port text
+		{"port:8080", []uint16{8080}},
+		{"PORT:80", []uint16{80}},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		var ports []uint16
+		for _, conn := range FilterQuery(conns, q) {
+			ports = append(ports, conn.LocalPort)
+		}
+		if len(ports) != len(test.ports) {
+			t.Errorf("%q matched ports %v, want %v", test.query, ports, test.ports)
+			continue
+		}
+		for i := range ports {
+			if ports[i] != test.ports[i] {
+				t.Errorf("%q matched ports %v, want %v", test.query, ports, test.ports)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"port:abc", "port:", "proto:sctp", `container:"open`, "!"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded", query)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	conns := []ConnectionInfo{
+		{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 8080, RemoteAddr: "0.0.0.0", State: "LISTEN", PID: 100, ProcessName: "nginx"},
+		{Protocol: "TCP", LocalAddr: "10.0.0.5", LocalPort: 50000, RemoteAddr: "10.0.0.9", RemotePort: 5432, State: "ESTABLISHED", PID: 300, ProcessName: "psql"},
+		{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 8050, RemoteAddr: "127.0.0.1", RemotePort: 40000, State: "TIME_WAIT"},
+		{Protocol: "UDP", LocalAddr: "0.0.0.0", LocalPort: 53, PID: 400, ProcessName: "dnsmasq"},
+		{Protocol: "UNIX", SocketType: "STREAM", LocalAddr: "/run/app.sock", State: "LISTEN", PID: 100, ProcessName: "my app"},
+	}
+	tests := []struct {
+		query string
+		want  []int // Indexes of the matching connections
+	}{
+		{"", []int{0, 1, 2, 3, 4}},
+		{"port:8080", []int{0}},
+		{"port:5432", []int{1}},
+		{"port:8000-8100", []int{0, 2}},
+		{"port:53,5432", []int{1, 3}},
+		{"port:53,8000-8100", []int{0, 2, 3}},
+		{"lport:5432", nil},
+		{"rport:40000", []int{2}},
+		{"!port:8000-8100", []int{1, 3, 4}},
+		{"-port:8000-8100", []int{1, 3, 4}},
+		{"state:listen", []int{0, 4}},
+		{"status:TIME_WAIT", []int{2}},
+		{"state:established,time_wait", []int{1, 2}},
+		{"-state:LISTEN", []int{1, 2, 3}},
+		{"proto:udp", []int{3}},
+		{"type:UNIX", []int{4}},
+		{"proto:tcp,udp", []int{0, 1, 2, 3}},
+		{"!proto:tcp", []int{3, 4}},
+		{"pid:100", []int{0, 4}},
+		{"pid:100,400", []int{0, 3, 4}},
+		{`proc:"my app"`, []int{4}},
+		{`"my app"`, []int{4}},
+		{`program:"nginx"`, []int{0}},
+		{"proc:nginx state:listen", []int{0}},
+		{"proto:tcp !state:listen port:5432", []int{1}},
+		{"remote:10.0.0.0/8", []int{1}},
+		{"-10.0.0", []int{0, 2, 3, 4}},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		var got []int
+		for i, conn := range conns {
+			if q.Match(conn) {
+				got = append(got, i)
+			}
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q matched %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestQueryErrorPos(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"port:abc", 5},
+		{"proc:nginx port:80-70", 16},
+		{"proc:nginx port:8000-", 16},
+		{"port:80,,81", 5},
+		{"proto:tcp,sctp", 6},
+		{"state:listen pid:", 17},
+		{"state:listen  pid:-1", 18},
+		{`proc:x container:"open`, 17},
+		{"port:80 !", 8},
+	}
+	for _, test := range tests {
+		_, err := ParseQuery(test.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseQuery(%q) = %v, want a QueryError", test.query, err)
+			continue
+		}
+		if queryErr.Pos != test.pos {
+			t.Errorf("ParseQuery(%q) error at %d (%s), want %d", test.query, queryErr.Pos, queryErr.Msg, test.pos)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package system
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnectionRates are the transfer rates of a connection in bytes per
+// second, measured between two snapshots
+type ConnectionRates struct {
+	InPerSec  float64
+	OutPerSec float64
+}
+
+type rateSample struct {
+	inode uint64
+	in    uint64
+	out   uint64
+	at    time.Time
+}
+
+// rateSampleMaxAge limits how long the counters of a connection that is
+// missing from the snapshots are kept
+const rateSampleMaxAge = 5 * time.Minute
+
+// RateMeter derives rates from the byte counters of successive snapshots.
+// A socket that was replaced (other inode) or whose counters went back
+// starts over and gets a rate again with the next snapshot. Filtered
+// snapshots keep the counters of the connections they leave out.
+type RateMeter struct {
+	mtx  sync.Mutex
+	prev map[ConnectionKey]rateSample
+}
+
+func NewRateMeter() *RateMeter {
+	var c RateMeter
+	c.prev = make(map[ConnectionKey]rateSample)
+	return &c
+}
+
+// Update sets the Rates of conns in place. Connections without byte
+// counters keep nil rates.
+func (c *RateMeter) Update(conns []ConnectionInfo, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	next := make(map[ConnectionKey]rateSample, len(conns))
+	for i := range conns {
+		conn := &conns[i]
+		if conn.Stats == nil || !conn.Stats.HasTCPInfo {
+			continue
+		}
+		key := KeyOf(*conn)
+		sample := rateSample{
+			inode: conn.Inode,
+			in:    conn.Stats.BytesReceived,
+			out:   conn.Stats.BytesAcked,
+			at:    now,
+		}
+		next[key] = sample
+
+		prev, ok := c.prev[key]
+		if !ok || prev.inode != sample.inode || sample.in < prev.in || sample.out < prev.out {
+			continue
+		}
+		elapsed := now.Sub(prev.at).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		conn.Rates = &ConnectionRates{
+			InPerSec:  float64(sample.in-prev.in) / elapsed,
+			OutPerSec: float64(sample.out-prev.out) / elapsed,
+		}
+	}
+
+	for key, sample := range c.prev {
+		if _, ok := next[key]; !ok && now.Sub(sample.at) < rateSampleMaxAge {
+			next[key] = sample
+		}
+	}
+	c.prev = next
+}
+
+// ProcessRates is the sum of the connection rates of one process
+type ProcessRates struct {
+	PID         uint32
+	ProcessName string
+	ConnectionRates
+}
+
+// SumProcessRates aggregates the rates per process, busiest first.
+// Processes without any measured connection are left out.
+func SumProcessRates(conns []ConnectionInfo) []ProcessRates {
+	byPID := make(map[uint32]*ProcessRates)
+	for _, conn := range conns {
+		if conn.Rates == nil {
+			continue
+		}
+		p, ok := byPID[conn.PID]
+		if !ok {
+			p = &ProcessRates{PID: conn.PID, ProcessName: conn.ProcessName}
+			byPID[conn.PID] = p
+		}
+		p.InPerSec += conn.Rates.InPerSec
+		p.OutPerSec += conn.Rates.OutPerSec
+	}
+
+	result := make([]ProcessRates, 0, len(byPID))
+	for _, p := range byPID {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		totalI := result[i].InPerSec + result[i].OutPerSec
+		totalJ := result[j].InPerSec + result[j].OutPerSec
+		if totalI != totalJ {
+			return totalI > totalJ
+		}
+		return result[i].PID < result[j].PID
+	})
+	return result
+}
+
+func rateValue(conn ConnectionInfo, column string) (float64, bool) {
+	if conn.Rates == nil {
+		return 0, false
+	}
+	switch column {
+	case ColumnRateIn:
+		return conn.Rates.InPerSec, true
+	case ColumnRateOut:
+		return conn.Rates.OutPerSec, true
+	}
+	return 0, false
+}
+
+// compareRates orders connections without a rate before all others
+func compareRates(a ConnectionInfo, b ConnectionInfo, column string) int {
+	valueA, okA := rateValue(a, column)
+	valueB, okB := rateValue(b, column)
+	if okA != okB {
+		if okA {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Compare(valueA, valueB)
+}
+
+// FormatRate renders bytes per second with a binary unit (1.5 MiB/s)
+func FormatRate(bytesPerSec float64) string {
+	return fmt.Sprintf("%s/s", FormatBytes(uint64(bytesPerSec)))
+}
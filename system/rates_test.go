@@ -0,0 +1,122 @@
+package system
+
+import (
+	"testing"
+	"time"
+)
+
+func rateConn(inode uint64, received uint64, acked uint64) ConnectionInfo {
+	return ConnectionInfo{
+		Protocol:   "TCP",
+		LocalAddr:  "10.0.0.5",
+		LocalPort:  50000,
+		RemoteAddr: "192.168.1.10",
+		RemotePort: 443,
+		State:      "ESTABLISHED",
+		Inode:      inode,
+		Stats:      &ConnectionStats{HasTCPInfo: true, BytesReceived: received, BytesAcked: acked},
+	}
+}
+
+func TestRateMeterUpdate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		conn ConnectionInfo
+		in   float64 // Expected rates, -1 for none
+		out  float64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first sample has no rate", []step{
+			{rateConn(1, 1000, 500), -1, -1},
+		}},
+		{"rate over two samples", []step{
+			{rateConn(1, 1000, 500), -1, -1},
+			{rateConn(1, 3000, 1500), 2000, 1000},
+			{rateConn(1, 3000, 1500), 0, 0},
+		}},
+		{"new inode on the same tuple", []step{
+			{rateConn(1, 1<<30, 1<<30), -1, -1},
+			{rateConn(2, 100, 50), -1, -1},
+			{rateConn(2, 1100, 550), 1000, 500},
+		}},
+		{"received counter went back", []step{
+			{rateConn(1, 5000, 500), -1, -1},
+			{rateConn(1, 100, 600), -1, -1},
+			{rateConn(1, 300, 800), 200, 200},
+		}},
+		{"acked counter went back", []step{
+			{rateConn(1, 500, 5000), -1, -1},
+			{rateConn(1, 600, 100), -1, -1},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meter := NewRateMeter()
+			for i, s := range test.steps {
+				conns := []ConnectionInfo{s.conn}
+				meter.Update(conns, start.Add(time.Duration(i)*time.Second))
+				rates := conns[0].Rates
+				if s.in < 0 {
+					if rates != nil {
+						t.Errorf("step %d: rates = %+v, want none", i, *rates)
+					}
+					continue
+				}
+				if rates == nil {
+					t.Fatalf("step %d: no rates", i)
+				}
+				if rates.InPerSec != s.in || rates.OutPerSec != s.out {
+					t.Errorf("step %d: rates = %+v, want %v in, %v out", i, *rates, s.in, s.out)
+				}
+			}
+		})
+	}
+}
+
+func TestRateMeterKeepsFilteredConnections(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	meter := NewRateMeter()
+	meter.Update([]ConnectionInfo{rateConn(1, 0, 0)}, start)
+	// A snapshot that leaves the connection out, e.g. filtered to LISTEN
+	meter.Update(nil, start.Add(time.Second))
+
+	conns := []ConnectionInfo{rateConn(1, 4000, 0)}
+	meter.Update(conns, start.Add(2*time.Second))
+	if conns[0].Rates == nil || conns[0].Rates.InPerSec != 2000 {
+		t.Errorf("rates = %+v, want 2000 in", conns[0].Rates)
+	}
+
+	// Past rateSampleMaxAge the old counters are dropped
+	meter.Update(nil, start.Add(2*time.Second+rateSampleMaxAge))
+	conns = []ConnectionInfo{rateConn(1, 8000, 0)}
+	meter.Update(conns, start.Add(3*time.Second+rateSampleMaxAge))
+	if conns[0].Rates != nil {
+		t.Errorf("rates = %+v after the sample expired", *conns[0].Rates)
+	}
+}
+
+func TestRateMeterWithoutCounters(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	meter := NewRateMeter()
+	conn := rateConn(1, 0, 0)
+	conn.Stats.HasTCPInfo = false
+	for i := range 2 {
+		conns := []ConnectionInfo{conn}
+		meter.Update(conns, start.Add(time.Duration(i)*time.Second))
+		if conns[0].Rates != nil {
+			t.Errorf("rates = %+v without tcp_info", *conns[0].Rates)
+		}
+	}
+
+	// The same time twice gives no rate instead of a division by zero
+	conns := []ConnectionInfo{rateConn(1, 0, 0)}
+	meter.Update(conns, start)
+	conns = []ConnectionInfo{rateConn(1, 100, 0)}
+	meter.Update(conns, start)
+	if conns[0].Rates != nil {
+		t.Errorf("rates = %+v with no time elapsed", *conns[0].Rates)
+	}
+}
@@ -0,0 +1,219 @@
+package system
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ConnectionRecord is ConnectionInfo enriched with service and country,
+// as exported by the command line. The JSON names and the CSV column
+// order are part of the output format and must stay stable.
+type ConnectionRecord struct {
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address"`
+	LocalPort     uint16 `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    uint16 `json:"remote_port"`
+	State         string `json:"state"`
+	PID           uint32 `json:"pid"`
+	Program       string `json:"program"`
+	Service       string `json:"service"`
+	Country       string `json:"country"`
+	CountryISO    string `json:"country_iso"`
+
+	ParentPID          uint32 `json:"parent_pid"`
+	ProcessPath        string `json:"process_path"`
+	ProcessCommandLine string `json:"process_command_line"`
+	ProcessUser        string `json:"process_user"`
+	ProcessStartTime   string `json:"process_start_time"`
+
+	// Socket statistics, null when the collector does not provide them
+	RTTMillis     *float64 `json:"rtt_ms"`
+	Retransmits   *uint32  `json:"retransmits"`
+	SendQueue     *uint32  `json:"send_queue"`
+	RecvQueue     *uint32  `json:"recv_queue"`
+	BytesAcked    *uint64  `json:"bytes_acked"`
+	BytesReceived *uint64  `json:"bytes_received"`
+
+	// Transfer rates in bytes per second, null until measured
+	RateIn  *float64 `json:"rate_in"`
+	RateOut *float64 `json:"rate_out"`
+
+	SocketType string `json:"socket_type"`
+
+	Container   string `json:"container"`
+	ContainerID string `json:"container_id"`
+	PodUID      string `json:"pod_uid"`
+	Unit        string `json:"unit"`
+
+	NetNS      string `json:"netns"`
+	NetNSInode uint64 `json:"netns_inode"`
+
+	// systemd units of a socket held by systemd for socket activation
+	SocketUnit    string `json:"socket_unit"`
+	SocketService string `json:"socket_service"`
+}
+
+func NewConnectionRecord(conn ConnectionInfo) ConnectionRecord {
+	var r ConnectionRecord
+	r.Protocol = conn.Protocol
+	r.SocketType = conn.SocketType
+	r.Container = ContainerLabel(conn)
+	r.ContainerID = conn.Process.Container.ID
+	r.PodUID = conn.Process.Container.PodUID
+	r.Unit = conn.Process.Container.Unit
+	r.NetNS = NetNSLabel(conn)
+	r.NetNSInode = conn.NetNS
+	if activation, ok := SystemdSocketUnit(conn); ok {
+		r.SocketUnit = activation.Socket
+		r.SocketService = activation.Service
+	}
+	r.LocalAddress = conn.LocalAddr
+	r.LocalPort = conn.LocalPort
+	r.State = conn.State
+	r.PID = conn.PID
+	r.Program = conn.ProcessName
+	r.Service = serviceByConnection(conn)
+	r.ParentPID = conn.Process.ParentPID
+	r.ProcessPath = conn.Process.ExePath
+	r.ProcessCommandLine = conn.Process.CommandLine
+	r.ProcessUser = conn.Process.User
+	if !conn.Process.StartTime.IsZero() {
+		r.ProcessStartTime = conn.Process.StartTime.Format(time.RFC3339)
+	}
+
+	if s := conn.Stats; s != nil {
+		r.Retransmits = &s.Retransmits
+		r.SendQueue = &s.SendQueue
+		r.RecvQueue = &s.RecvQueue
+		if s.HasTCPInfo {
+			rtt := float64(s.RTT) / float64(time.Millisecond)
+			r.RTTMillis = &rtt
+			r.BytesAcked = &s.BytesAcked
+			r.BytesReceived = &s.BytesReceived
+		}
+	}
+
+	if conn.Rates != nil {
+		r.RateIn = &conn.Rates.InPerSec
+		r.RateOut = &conn.Rates.OutPerSec
+	}
+
+	// A listening socket has no peer, same as in the table
+	if conn.State != "LISTEN" {
+		r.RemoteAddress = conn.RemoteAddr
+		r.RemotePort = conn.RemotePort
+	}
+
+	country, err := GetCountryByIP(r.RemoteAddress)
+	if err == nil {
+		r.Country = country
+	}
+	countryISO, err := GetCountryISOCodeByIP(r.RemoteAddress)
+	if err == nil {
+		r.CountryISO = countryISO
+	}
+	return r
+}
+
+func NewConnectionRecords(conns []ConnectionInfo) []ConnectionRecord {
+	result := make([]ConnectionRecord, 0, len(conns))
+	for _, conn := range conns {
+		result = append(result, NewConnectionRecord(conn))
+	}
+	return result
+}
+
+// RecordHeader returns the CSV column names in Fields order
+func RecordHeader() []string {
+	return []string{
+		"protocol",
+		"local_address",
+		"local_port",
+		"remote_address",
+		"remote_port",
+		"state",
+		"pid",
+		"program",
+		"service",
+		"country",
+		"country_iso",
+		"parent_pid",
+		"process_path",
+		"process_command_line",
+		"process_user",
+		"process_start_time",
+		"rtt_ms",
+		"retransmits",
+		"send_queue",
+		"recv_queue",
+		"bytes_acked",
+		"bytes_received",
+		"rate_in",
+		"rate_out",
+		"socket_type",
+		"container",
+		"container_id",
+		"pod_uid",
+		"unit",
+		"netns",
+		"netns_inode",
+		"socket_unit",
+		"socket_service",
+	}
+}
+
+func (r ConnectionRecord) Fields() []string {
+	localPort := strconv.FormatUint(uint64(r.LocalPort), 10)
+	if r.Protocol == "UNIX" {
+		localPort = ""
+	}
+	remotePort := ""
+	if r.RemotePort > 0 {
+		remotePort = strconv.FormatUint(uint64(r.RemotePort), 10)
+	}
+	return []string{
+		r.Protocol,
+		r.LocalAddress,
+		localPort,
+		r.RemoteAddress,
+		remotePort,
+		r.State,
+		strconv.FormatUint(uint64(r.PID), 10),
+		r.Program,
+		r.Service,
+		r.Country,
+		r.CountryISO,
+		strconv.FormatUint(uint64(r.ParentPID), 10),
+		r.ProcessPath,
+		r.ProcessCommandLine,
+		r.ProcessUser,
+		r.ProcessStartTime,
+		formatOptional(r.RTTMillis),
+		formatOptional(r.Retransmits),
+		formatOptional(r.SendQueue),
+		formatOptional(r.RecvQueue),
+		formatOptional(r.BytesAcked),
+		formatOptional(r.BytesReceived),
+		formatOptional(r.RateIn),
+		formatOptional(r.RateOut),
+		r.SocketType,
+		r.Container,
+		r.ContainerID,
+		r.PodUID,
+		r.Unit,
+		r.NetNS,
+		strconv.FormatUint(r.NetNSInode, 10),
+		r.SocketUnit,
+		r.SocketService,
+	}
+}
+
+// formatOptional renders a CSV field, empty for nil
+func formatOptional[T float64 | uint32 | uint64](v *T) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(*v)
+}
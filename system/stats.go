@@ -0,0 +1,110 @@
+package system
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+)
+
+// ConnectionStats are the health counters of a socket. The queues and
+// the retransmit count come from every Linux collector; RTT and the byte
+// counters need tcp_info and are only valid when HasTCPInfo is set.
+type ConnectionStats struct {
+	SendQueue   uint32 // Bytes not yet acknowledged by the peer
+	RecvQueue   uint32 // Bytes not yet read by the process
+	Retransmits uint32 // Retransmitted segments
+
+	HasTCPInfo    bool
+	RTT           time.Duration
+	BytesAcked    uint64 // Bytes sent and acknowledged by the peer
+	BytesReceived uint64
+}
+
+// StatsColumns are the socket statistics and rate columns, which the
+// window shows and hides together
+var StatsColumns = []string{
+	ColumnRTT,
+	ColumnRetransmits,
+	ColumnSendQueue,
+	ColumnRecvQueue,
+	ColumnBytesAcked,
+	ColumnBytesReceived,
+	ColumnRateIn,
+	ColumnRateOut,
+}
+
+// statsValue returns the value of a statistics column, ok is false when
+// the connection has no such value
+func statsValue(conn ConnectionInfo, column string) (uint64, bool) {
+	s := conn.Stats
+	if s == nil {
+		return 0, false
+	}
+	switch column {
+	case ColumnSendQueue:
+		return uint64(s.SendQueue), true
+	case ColumnRecvQueue:
+		return uint64(s.RecvQueue), true
+	case ColumnRetransmits:
+		return uint64(s.Retransmits), true
+	case ColumnRTT:
+		return uint64(s.RTT), s.HasTCPInfo
+	case ColumnBytesAcked:
+		return s.BytesAcked, s.HasTCPInfo
+	case ColumnBytesReceived:
+		return s.BytesReceived, s.HasTCPInfo
+	}
+	return 0, false
+}
+
+// compareStats orders connections without the value before all others
+func compareStats(a ConnectionInfo, b ConnectionInfo, column string) int {
+	valueA, okA := statsValue(a, column)
+	valueB, okB := statsValue(b, column)
+	if okA != okB {
+		if okA {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Compare(valueA, valueB)
+}
+
+// FormatStat renders a statistics or rate column for the table, empty
+// when the connection has no such value
+func FormatStat(conn ConnectionInfo, column string) string {
+	if column == ColumnRateIn || column == ColumnRateOut {
+		rate, ok := rateValue(conn, column)
+		if !ok {
+			return ""
+		}
+		return FormatRate(rate)
+	}
+
+	value, ok := statsValue(conn, column)
+	if !ok {
+		return ""
+	}
+	switch column {
+	case ColumnRTT:
+		return fmt.Sprintf("%.1f ms", float64(value)/float64(time.Millisecond))
+	case ColumnBytesAcked, ColumnBytesReceived:
+		return FormatBytes(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// FormatBytes renders a byte count with a binary unit (1.5 MiB)
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -2,11 +2,9 @@ package system
 
 import (
 	"sync"
-	"syscall"
 	"time"
-	"unsafe"
 
-	"golang.org/x/sys/windows"
+	"github.com/u00io/gomisc/logger"
 )
 
 type System struct {
@@ -14,21 +12,34 @@ type System struct {
 
 	events []Event
 
-	filterType   string
-	filterStatus string
+	filterType      string
+	filterStatus    string
+	filterNamespace string
+	filterQuery     *Query
+	filterQueryText string
 
-	processNamesById map[uint32]string
+	processesById map[uint32]ProcessInfo
+
+	differ       *Differ
+	history      *History
+	rates        *RateMeter
+	processRates []ProcessRates
 }
 
 type Event struct {
 	Name      string
 	Parameter string
+
+	// Change is set for the connection_* events
+	Change *ConnectionChange
 }
 
 var Instance *System
 
 func NewSystem() *System {
 	var c System
+	c.differ = NewDiffer()
+	c.rates = NewRateMeter()
 	return &c
 }
 
@@ -46,35 +57,10 @@ func (c *System) thUpdateProcesses() {
 	}
 }
 
-func (c *System) updateProcesses() {
-	result := make(map[uint32]string)
-
-	handle, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
-	if err == nil {
-		var entry windows.ProcessEntry32
-		entry.Size = uint32(unsafe.Sizeof(entry))
-		err = windows.Process32First(handle, &entry)
-		for err == nil {
-			nameSize := 0
-			for i := 0; i < 260; i++ {
-				if entry.ExeFile[nameSize] == 0 {
-					break
-				}
-				nameSize++
-			}
-
-			id := int(entry.ProcessID)
-			name := syscall.UTF16ToString(entry.ExeFile[:nameSize])
-			result[uint32(id)] = name
-			err = windows.Process32Next(handle, &entry)
-		}
-
-		_ = windows.CloseHandle(handle)
-	}
-
-	c.mtx.Lock()
-	c.processNamesById = result
-	c.mtx.Unlock()
+// UpdateProcesses reloads the process list once. Used in headless mode,
+// where the update loop of Start is not running.
+func (c *System) UpdateProcesses() {
+	c.updateProcesses()
 }
 
 func (c *System) SetFilterType(filterType string) {
@@ -89,6 +75,26 @@ func (c *System) SetFilterStatus(filterStatus string) {
 	c.mtx.Unlock()
 }
 
+func (c *System) SetFilterNamespace(filterNamespace string) {
+	c.mtx.Lock()
+	c.filterNamespace = filterNamespace
+	c.mtx.Unlock()
+}
+
+// SetFilterQuery sets the search of the connection table. An invalid
+// query is returned as error and leaves the previous one in place.
+func (c *System) SetFilterQuery(text string) error {
+	query, err := ParseQuery(text)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	c.filterQuery = query
+	c.filterQueryText = text
+	c.mtx.Unlock()
+	return nil
+}
+
 func (c *System) GetFilterType() string {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
@@ -101,12 +107,71 @@ func (c *System) GetFilterStatus() string {
 	return c.filterStatus
 }
 
+func (c *System) GetFilterNamespace() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.filterNamespace
+}
+
+// GetFilterQuery returns the search, nil when none is set
+func (c *System) GetFilterQuery() *Query {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.filterQuery
+}
+
+func (c *System) GetFilterQueryText() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.filterQueryText
+}
+
 func (c *System) EmitEvent(event string, parameter string) {
 	c.mtx.Lock()
 	c.events = append(c.events, Event{Name: event, Parameter: parameter})
 	c.mtx.Unlock()
 }
 
+// ProcessSnapshot compares the snapshot with the previous one and emits
+// an event for every opened, closed or changed connection. The transfer
+// rates of the connections are filled in place.
+func (c *System) ProcessSnapshot(snapshot NetworkConnections) []ConnectionChange {
+	c.rates.Update(snapshot.Connections, time.Now())
+	processRates := SumProcessRates(snapshot.Connections)
+	changes := c.differ.Update(snapshot.Connections)
+
+	c.mtx.Lock()
+	c.processRates = processRates
+	history := c.history
+	for i := range changes {
+		change := changes[i]
+		c.events = append(c.events, Event{Name: string(change.Type), Parameter: change.Key.String(), Change: &change})
+	}
+	c.mtx.Unlock()
+
+	if history != nil {
+		if err := history.Record(changes, time.Now()); err != nil {
+			logger.Println("history error:", err)
+		}
+	}
+	return changes
+}
+
+// GetProcessRates returns the per-process rates of the last snapshot,
+// busiest first
+func (c *System) GetProcessRates() []ProcessRates {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.processRates
+}
+
+// SetHistory enables recording of connection lifetimes
+func (c *System) SetHistory(history *History) {
+	c.mtx.Lock()
+	c.history = history
+	c.mtx.Unlock()
+}
+
 func (c *System) GetAndClearEvents() []Event {
 	c.mtx.Lock()
 	events := c.events
@@ -115,35 +180,47 @@ func (c *System) GetAndClearEvents() []Event {
 	return events
 }
 
+// IsLocalAreaNetwork reports private (RFC 1918, fc00::/7) and link-local addresses
 func (c *System) IsLocalAreaNetwork(ip string) bool {
-	if len(ip) >= 4 {
-		if ip[:4] == "10." {
-			return true
-		}
-		if len(ip) >= 8 {
-			if ip[:8] == "192.168." {
-				return true
-			}
-			if len(ip) >= 7 {
-				if ip[:7] == "172.16." {
-					return true
-				}
-			}
-		}
-	}
-	return false
+	return isLocalAreaNetwork(ip)
+}
+
+func (c *System) IsLoopbackOrUnspecified(ip string) bool {
+	return isLoopbackOrUnspecified(ip)
 }
 
 func (c *System) GetProcessName(pid uint32) string {
 	result := "?"
 	c.mtx.Lock()
-	if name, ok := c.processNamesById[pid]; ok {
-		result = name
+	if process, ok := c.processesById[pid]; ok {
+		result = process.Name
 	}
 	c.mtx.Unlock()
 	return result
 }
 
+// GetProcess returns the details of the process, or just the PID and "?"
+// as name when the process is unknown
+func (c *System) GetProcess(pid uint32) ProcessInfo {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if process, ok := c.processesById[pid]; ok {
+		return process
+	}
+	return ProcessInfo{PID: pid, Name: "?"}
+}
+
+// GetProcesses returns a copy of the process list
+func (c *System) GetProcesses() map[uint32]ProcessInfo {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	result := make(map[uint32]ProcessInfo, len(c.processesById))
+	for pid, process := range c.processesById {
+		result[pid] = process
+	}
+	return result
+}
+
 func (c *System) GetServiceByPort(port uint16) string {
 	if service, ok := portServiceMap[port]; ok {
 		return service
@@ -151,6 +228,21 @@ func (c *System) GetServiceByPort(port uint16) string {
 	return ""
 }
 
+// GetServiceByConnection looks up the local port first, then the remote one
+func (c *System) GetServiceByConnection(conn ConnectionInfo) string {
+	return serviceByConnection(conn)
+}
+
+func serviceByConnection(conn ConnectionInfo) string {
+	if service, ok := portServiceMap[conn.LocalPort]; ok {
+		return service
+	}
+	if service, ok := portServiceMap[conn.RemotePort]; ok {
+		return service
+	}
+	return ""
+}
+
 var portServiceMap = map[uint16]string{
 	// --- Well-known ports (0–1023)
 	20:  "FTP Data",
@@ -0,0 +1,288 @@
+package system
+
+import (
+	"bufio"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SystemdUnitDirs are searched for .socket units, the first directory
+// that has a unit wins like with systemd
+var SystemdUnitDirs = []string{
+	"/etc/systemd/system",
+	"/run/systemd/system",
+	"/usr/local/lib/systemd/system",
+	"/usr/lib/systemd/system",
+	"/lib/systemd/system",
+}
+
+// systemdRefreshInterval is how old the parsed unit files may get
+const systemdRefreshInterval = 30 * time.Second
+
+// SocketActivation names the systemd units behind a socket that systemd
+// opened for socket activation
+type SocketActivation struct {
+	Socket  string // e.g. "cups.socket"
+	Service string // Unit started for the socket, e.g. "cups.service"
+}
+
+type socketUnit struct {
+	SocketActivation
+	listen []socketListen
+}
+
+// socketListen is one ListenStream=, ListenDatagram= or
+// ListenSequentialPacket= of a socket unit
+type socketListen struct {
+	protocol   string // "TCP", "UDP" or "UNIX"
+	socketType string // For UNIX
+	addr       string // IP address, "" for any, or the path of a UNIX socket
+	port       uint16
+}
+
+var systemdUnitsMtx sync.Mutex
+var systemdUnits []socketUnit
+var systemdUnitsUpdated time.Time
+
+// SystemdSocketUnit finds the socket unit of a socket held by systemd
+// itself (PID 1). Sockets that were passed to a running service are
+// attributed to the service process by SocketOwners instead.
+func SystemdSocketUnit(conn ConnectionInfo) (SocketActivation, bool) {
+	if conn.PID != 1 || conn.Process.Name != "systemd" {
+		return SocketActivation{}, false
+	}
+	if conn.Protocol == "TCP" && conn.State != "LISTEN" {
+		return SocketActivation{}, false
+	}
+
+	systemdUnitsMtx.Lock()
+	defer systemdUnitsMtx.Unlock()
+	if time.Since(systemdUnitsUpdated) >= systemdRefreshInterval {
+		systemdUnits = loadSocketUnits(SystemdUnitDirs)
+		systemdUnitsUpdated = time.Now()
+	}
+
+	for _, unit := range systemdUnits {
+		for _, listen := range unit.listen {
+			if listen.match(conn) {
+				return unit.SocketActivation, true
+			}
+		}
+	}
+	return SocketActivation{}, false
+}
+
+// ProgramLabel is the process name of the connection, followed by the
+// socket unit when systemd holds the socket
+func ProgramLabel(conn ConnectionInfo) string {
+	if activation, ok := SystemdSocketUnit(conn); ok {
+		return conn.ProcessName + " (" + activation.Socket + ")"
+	}
+	return conn.ProcessName
+}
+
+func (l socketListen) match(conn ConnectionInfo) bool {
+	if l.protocol != conn.Protocol {
+		return false
+	}
+	if l.protocol == "UNIX" {
+		return l.socketType == conn.SocketType && l.addr == conn.LocalAddr
+	}
+	if l.port != conn.LocalPort {
+		return false
+	}
+	if l.addr == "" {
+		return true
+	}
+	want, err := netip.ParseAddr(l.addr)
+	if err != nil {
+		return false
+	}
+	got, err := netip.ParseAddr(conn.LocalAddr)
+	if err != nil {
+		return false
+	}
+	return want.Unmap().WithZone("") == got.Unmap().WithZone("")
+}
+
+// loadSocketUnits parses the .socket units of dirs together with their
+// drop-ins (<unit>.d/*.conf). Templates (name@.socket) are skipped, they
+// only listen through their instances.
+func loadSocketUnits(dirs []string) []socketUnit {
+	files := make(map[string]string)
+	var names []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasSuffix(name, ".socket") || strings.HasSuffix(name, "@.socket") {
+				continue
+			}
+			if _, exists := files[name]; !exists {
+				files[name] = filepath.Join(dir, name)
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]socketUnit, 0, len(names))
+	for _, name := range names {
+		paths := append([]string{files[name]}, dropInFiles(dirs, name)...)
+		unit, err := parseSocketUnit(name, paths)
+		if err != nil || len(unit.listen) == 0 {
+			continue
+		}
+		result = append(result, unit)
+	}
+	return result
+}
+
+// dropInFiles returns the *.conf drop-ins of a unit ordered by file name.
+// A drop-in shadows the ones with the same name in later directories.
+func dropInFiles(dirs []string, unit string) []string {
+	files := make(map[string]string)
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, unit+".d", "*.conf"))
+		for _, path := range matches {
+			if _, exists := files[filepath.Base(path)]; !exists {
+				files[filepath.Base(path)] = path
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, files[name])
+	}
+	return result
+}
+
+// parseSocketUnit reads the [Socket] section of the unit file and its
+// drop-ins in order. An empty Listen*= clears the list, as in systemd.
+func parseSocketUnit(name string, paths []string) (socketUnit, error) {
+	var unit socketUnit
+	unit.Socket = name
+	accept := false
+	service := ""
+
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			if i == 0 {
+				return unit, err
+			}
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		section := ""
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+				continue
+			}
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(line, "[]")
+				continue
+			}
+			if section != "Socket" {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+
+			switch key {
+			case "ListenStream", "ListenDatagram", "ListenSequentialPacket":
+				if value == "" {
+					unit.listen = nil
+					continue
+				}
+				if listen, ok := parseListen(key, value); ok {
+					unit.listen = append(unit.listen, listen)
+				}
+			case "Service":
+				service = value
+			case "Accept":
+				accept = value == "yes" || value == "true" || value == "1" || value == "on"
+			}
+		}
+		f.Close()
+	}
+
+	base := strings.TrimSuffix(name, ".socket")
+	switch {
+	case service != "":
+		unit.Service = service
+	case accept:
+		// Every connection gets an instance of the template
+		unit.Service = base + "@.service"
+	default:
+		unit.Service = base + ".service"
+	}
+	return unit, nil
+}
+
+// parseListen parses the address of a Listen*= setting: a port, an
+// address with port ("127.0.0.1:631", "[::1]:631") or a UNIX socket path.
+// Netlink, vsock and other families are not supported.
+func parseListen(key string, value string) (socketListen, bool) {
+	var l socketListen
+
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, "%t/") || strings.HasPrefix(value, "@") {
+		l.protocol = "UNIX"
+		l.addr = strings.Replace(value, "%t", "/run", 1)
+		switch key {
+		case "ListenStream":
+			l.socketType = "STREAM"
+		case "ListenDatagram":
+			l.socketType = "DGRAM"
+		default:
+			l.socketType = "SEQPACKET"
+		}
+		return l, true
+	}
+
+	switch key {
+	case "ListenStream":
+		l.protocol = "TCP"
+	case "ListenDatagram":
+		l.protocol = "UDP"
+	default:
+		return l, false
+	}
+
+	portText := value
+	if index := strings.LastIndex(value, ":"); index >= 0 {
+		host := strings.Trim(value[:index], "[]")
+		// A link-local address may carry an interface
+		host, _, _ = strings.Cut(host, "%")
+		if _, err := netip.ParseAddr(host); err != nil {
+			return l, false
+		}
+		l.addr = host
+		portText = value[index+1:]
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return l, false
+	}
+	l.port = uint16(port)
+	return l, true
+}
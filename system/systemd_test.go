@@ -0,0 +1,146 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeUnitFiles creates the files under root, keyed by relative path
+func writeUnitFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		want  socketListen
+		ok    bool
+	}{
+		{"ListenStream", "631", socketListen{protocol: "TCP", port: 631}, true},
+		{"ListenStream", "127.0.0.1:631", socketListen{protocol: "TCP", addr: "127.0.0.1", port: 631}, true},
+		{"ListenStream", "[::1]:631", socketListen{protocol: "TCP", addr: "::1", port: 631}, true},
+		{"ListenStream", "[fe80::1%eth0]:22", socketListen{protocol: "TCP", addr: "fe80::1", port: 22}, true},
+		{"ListenDatagram", "0.0.0.0:5353", socketListen{protocol: "UDP", addr: "0.0.0.0", port: 5353}, true},
+		{"ListenStream", "/run/cups/cups.sock", socketListen{protocol: "UNIX", socketType: "STREAM", addr: "/run/cups/cups.sock"}, true},
+		{"ListenStream", "%t/cups/cups.sock", socketListen{protocol: "UNIX", socketType: "STREAM", addr: "/run/cups/cups.sock"}, true},
+		{"ListenDatagram", "/run/systemd/journal/syslog", socketListen{protocol: "UNIX", socketType: "DGRAM", addr: "/run/systemd/journal/syslog"}, true},
+		{"ListenSequentialPacket", "@seqpacket", socketListen{protocol: "UNIX", socketType: "SEQPACKET", addr: "@seqpacket"}, true},
+		{"ListenStream", "localhost:631", socketListen{}, false},
+		{"ListenStream", "70000", socketListen{}, false},
+		{"ListenSequentialPacket", "631", socketListen{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseListen(test.key, test.value)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("parseListen(%s=%s) = %+v, %v, want %+v, %v", test.key, test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLoadSocketUnits(t *testing.T) {
+	root := t.TempDir()
+	writeUnitFiles(t, root, map[string]string{
+		"lib/cups.socket": "[Unit]\nDescription=CUPS Scheduler\n\n[Socket]\nListenStream=%t/cups/cups.sock\nListenStream=631\n\n[Install]\nWantedBy=sockets.target\n",
+		// The local drop-in replaces the addresses, the vendor one with
+		// the same name is shadowed and the later one still applies
+		"etc/cups.socket.d/override.conf": "[Socket]\nListenStream=\nListenStream=[::1]:631\n",
+		"lib/cups.socket.d/override.conf": "[Socket]\nListenStream=9999\n",
+		"lib/cups.socket.d/zz-udp.conf":   "[Socket]\nListenDatagram=631\n",
+		// The local unit shadows the vendor unit
+		"etc/sshd.socket": "[Socket]\nListenStream=2222\nAccept=yes\n",
+		"lib/sshd.socket": "[Socket]\nListenStream=22\n",
+		"lib/dbus.socket": "[Socket]\nListenStream=/run/dbus/system_bus_socket\nService=dbus-broker.service\n",
+		// Templates only listen through their instances
+		"lib/getty@.socket": "[Socket]\nListenStream=23\n",
+		// A unit without addresses is left out
+		"lib/empty.socket":  "[Socket]\nListenStream=1234\nListenStream=\n",
+		"lib/empty.service": "[Service]\nExecStart=/bin/true\n",
+	})
+
+	units := loadSocketUnits([]string{filepath.Join(root, "etc"), filepath.Join(root, "missing"), filepath.Join(root, "lib")})
+	want := []socketUnit{
+		{SocketActivation{"cups.socket", "cups.service"}, []socketListen{
+			{protocol: "TCP", addr: "::1", port: 631},
+			{protocol: "UDP", port: 631},
+		}},
+		{SocketActivation{"dbus.socket", "dbus-broker.service"}, []socketListen{
+			{protocol: "UNIX", socketType: "STREAM", addr: "/run/dbus/system_bus_socket"},
+		}},
+		{SocketActivation{"sshd.socket", "sshd@.service"}, []socketListen{
+			{protocol: "TCP", port: 2222},
+		}},
+	}
+	if len(units) != len(want) {
+		t.Fatalf("got %d units, want %d: %+v", len(units), len(want), units)
+	}
+	for i := range want {
+		if units[i].SocketActivation != want[i].SocketActivation || !slices.Equal(units[i].listen, want[i].listen) {
+			t.Errorf("unit %d = %+v, want %+v", i, units[i], want[i])
+		}
+	}
+}
+
+func TestDropInFiles(t *testing.T) {
+	root := t.TempDir()
+	writeUnitFiles(t, root, map[string]string{
+		"etc/cups.socket.d/50-local.conf":  "",
+		"lib/cups.socket.d/50-local.conf":  "",
+		"lib/cups.socket.d/10-vendor.conf": "",
+		"lib/cups.socket.d/notes.txt":      "",
+	})
+	got := dropInFiles([]string{filepath.Join(root, "etc"), filepath.Join(root, "lib")}, "cups.socket")
+	want := []string{
+		filepath.Join(root, "lib/cups.socket.d/10-vendor.conf"),
+		filepath.Join(root, "etc/cups.socket.d/50-local.conf"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("dropInFiles = %v, want %v", got, want)
+	}
+}
+
+func TestSystemdSocketUnit(t *testing.T) {
+	root := t.TempDir()
+	writeUnitFiles(t, root, map[string]string{
+		"cups.socket": "[Socket]\nListenStream=127.0.0.1:631\nListenStream=%t/cups/cups.sock\n",
+	})
+	dirs := SystemdUnitDirs
+	SystemdUnitDirs = []string{root}
+	systemdUnitsUpdated = time.Time{}
+	defer func() {
+		SystemdUnitDirs = dirs
+		systemdUnitsUpdated = time.Time{}
+	}()
+
+	systemd := ProcessInfo{Name: "systemd"}
+	tests := []struct {
+		conn ConnectionInfo
+		ok   bool
+	}{
+		{ConnectionInfo{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 631, State: "LISTEN", PID: 1, Process: systemd}, true},
+		{ConnectionInfo{Protocol: "TCP", LocalAddr: "::ffff:127.0.0.1", LocalPort: 631, State: "LISTEN", PID: 1, Process: systemd}, true},
+		{ConnectionInfo{Protocol: "UNIX", SocketType: "STREAM", LocalAddr: "/run/cups/cups.sock", State: "LISTEN", PID: 1, Process: systemd}, true},
+		{ConnectionInfo{Protocol: "TCP", LocalAddr: "0.0.0.0", LocalPort: 631, State: "LISTEN", PID: 1, Process: systemd}, false},
+		{ConnectionInfo{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 631, State: "ESTABLISHED", PID: 1, Process: systemd}, false},
+		// The socket was passed to cupsd
+		{ConnectionInfo{Protocol: "TCP", LocalAddr: "127.0.0.1", LocalPort: 631, State: "LISTEN", PID: 700, Process: ProcessInfo{Name: "cupsd"}}, false},
+	}
+	for _, test := range tests {
+		activation, ok := SystemdSocketUnit(test.conn)
+		if ok != test.ok || (ok && activation != SocketActivation{"cups.socket", "cups.service"}) {
+			t.Errorf("%s %s:%d (%d): %+v, %v, want %v", test.conn.Protocol, test.conn.LocalAddr, test.conn.LocalPort, test.conn.PID, activation, ok, test.ok)
+		}
+	}
+}